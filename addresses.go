@@ -0,0 +1,83 @@
+// Copyright 2017 Yahoo Holdings Inc. 
+// Licensed under the terms of the 3-Clause BSD License.
+package main
+
+import (
+	"fmt"
+	"strings"
+
+	corev1 "k8s.io/api/core/v1"
+	"k8s.io/apimachinery/pkg/apis/meta/v1"
+	"k8s.io/apimachinery/pkg/runtime/schema"
+)
+
+const (
+	// addressBypassAnnotationKey allows the release of the addresses of the services in a namespace when set to true
+	// or to an RFC3339 expiry, along with a reason. The bypass annotation does not, as DNS records may still point
+	// to the addresses.
+	addressBypassAnnotationKey = "k8s-namespace-guard.admission.yahoo.com/allow-address-release"
+	// addressBypassExpiresAnnotationKey optionally holds the RFC3339 expiry of the address bypass annotation
+	addressBypassExpiresAnnotationKey = addressBypassAnnotationKey + "-expires"
+	// addressBypassReasonAnnotationKey holds the justification that is required for the address bypass annotation to be honored
+	addressBypassReasonAnnotationKey = addressBypassAnnotationKey + "-reason"
+
+	// causeTypeAddressRelease is the type of the status causes listing the services whose addresses would be released
+	causeTypeAddressRelease v1.CauseType = "AddressRelease"
+)
+
+// addressCheck blocks the deletion of namespaces holding services with an address reachable from outside the cluster
+var addressCheck = resourceCounter{
+	kind:    "external-address-services",
+	gvr:     schema.GroupVersionResource{Group: "", Version: "v1", Resource: "services"},
+	counter: externalServiceCounter,
+	risk: &riskCheck{
+		description: "holds services of type LoadBalancer or with external IPs, whose addresses would be released while DNS records may still point to them",
+		causeType:   causeTypeAddressRelease,
+		reason:      reasonAddressRelease,
+		describe:    describeService,
+		bypass:      &addressBypass,
+	},
+}
+
+// addressBypass are the annotations of the address bypass annotation
+var addressBypass = bypassAnnotations{key: addressBypassAnnotationKey, expiresKey: addressBypassExpiresAnnotationKey, reasonKey: addressBypassReasonAnnotationKey}
+
+// externalServiceCounter returns the services in namespace of type LoadBalancer or with external IPs
+func externalServiceCounter(namespace string) ([]v1.Object, error) {
+	list, err := clientset.CoreV1().Services(namespace).List(v1.ListOptions{})
+	if err != nil {
+		return nil, err
+	}
+	var objects []v1.Object
+	for i := range list.Items {
+		service := &list.Items[i]
+		if service.Spec.Type == corev1.ServiceTypeLoadBalancer || len(service.Spec.ExternalIPs) > 0 {
+			objects = append(objects, service)
+		}
+	}
+	return objects, nil
+}
+
+// describeService returns the name of a service along with its external addresses, e.g. "web (LoadBalancer 203.0.113.10)"
+func describeService(object v1.Object) string {
+	service, ok := object.(*corev1.Service)
+	if !ok {
+		return object.GetName()
+	}
+	var addresses []string
+	if service.Spec.Type == corev1.ServiceTypeLoadBalancer {
+		var ingresses []string
+		for _, ingress := range service.Status.LoadBalancer.Ingress {
+			if ingress.IP != "" {
+				ingresses = append(ingresses, ingress.IP)
+			} else if ingress.Hostname != "" {
+				ingresses = append(ingresses, ingress.Hostname)
+			}
+		}
+		addresses = append(addresses, strings.TrimSpace("LoadBalancer "+strings.Join(ingresses, " ")))
+	}
+	if len(service.Spec.ExternalIPs) > 0 {
+		addresses = append(addresses, "externalIPs "+strings.Join(service.Spec.ExternalIPs, " "))
+	}
+	return fmt.Sprintf("%s (%s)", service.Name, strings.Join(addresses, ", "))
+}
@@ -0,0 +1,143 @@
+// Copyright 2017 Yahoo Holdings Inc. 
+// Licensed under the terms of the 3-Clause BSD License.
+package main
+
+import (
+	"net/http/httptest"
+	"sort"
+	"testing"
+	"time"
+
+	corev1 "k8s.io/api/core/v1"
+	"k8s.io/apimachinery/pkg/apis/meta/v1"
+	"k8s.io/client-go/kubernetes/fake"
+
+	"github.com/stretchr/testify/assert"
+)
+
+func newLoadBalancer(name, ip string) *corev1.Service {
+	return &corev1.Service{
+		ObjectMeta: v1.ObjectMeta{Name: name, Namespace: "test-namespace"},
+		Spec:       corev1.ServiceSpec{Type: corev1.ServiceTypeLoadBalancer},
+		Status: corev1.ServiceStatus{LoadBalancer: corev1.LoadBalancerStatus{
+			Ingress: []corev1.LoadBalancerIngress{{IP: ip}},
+		}},
+	}
+}
+
+func TestExternalServiceCounter(t *testing.T) {
+	clientset = fake.NewSimpleClientset(
+		newLoadBalancer("web", "203.0.113.10"),
+		&corev1.Service{
+			ObjectMeta: v1.ObjectMeta{Name: "api", Namespace: "test-namespace"},
+			Spec:       corev1.ServiceSpec{Type: corev1.ServiceTypeClusterIP, ExternalIPs: []string{"198.51.100.7"}},
+		},
+		&corev1.Service{
+			ObjectMeta: v1.ObjectMeta{Name: "internal", Namespace: "test-namespace"},
+			Spec:       corev1.ServiceSpec{Type: corev1.ServiceTypeClusterIP},
+		},
+	)
+
+	objects, err := externalServiceCounter("test-namespace")
+	assert.Nil(t, err, "Error should be nil")
+	var descriptions []string
+	for _, object := range objects {
+		descriptions = append(descriptions, describeService(object))
+	}
+	sort.Strings(descriptions)
+	assert.Equal(t, []string{"api (externalIPs 198.51.100.7)", "web (LoadBalancer 203.0.113.10)"}, descriptions,
+		"should only count the services with an external address")
+
+	assert.Equal(t, "pending (LoadBalancer)", describeService(&corev1.Service{
+		ObjectMeta: v1.ObjectMeta{Name: "pending"},
+		Spec:       corev1.ServiceSpec{Type: corev1.ServiceTypeLoadBalancer},
+	}), "should describe load balancers without an address yet")
+}
+
+func TestAddressReleaseWebhookHandler(t *testing.T) {
+	testNamespace := cloneNamespace(templateNamespace)
+	testNamespace.Annotations = map[string]string{
+		bypassAnnotationKey:       "true",
+		bypassReasonAnnotationKey: "migrating to another cluster",
+	}
+	clientset = fake.NewSimpleClientset(newLoadBalancer("web", "203.0.113.10"), testNamespace)
+
+	rw := httptest.NewRecorder()
+	req := httptest.NewRequest("POST", "http://localhost:8080/", constructPostBody(cloneAdmissionReview(templateAdmReview)))
+	webhookHandler(rw, req)
+
+	admReview := getAdmissionReview(rw)
+	assert.False(t, admReview.Status.Allowed, "should reject if the bypass annotation is set but a load balancer would be released")
+	assert.Contains(t, admReview.Status.Result.Reason, "services of type LoadBalancer or with external IPs, "+
+		"whose addresses would be released while DNS records may still point to them: web (LoadBalancer 203.0.113.10).")
+	assert.Contains(t, admReview.Status.Result.Reason, "set "+addressBypassAnnotationKey+"=<RFC3339 expiry> "+addressBypassReasonAnnotationKey+`="<reason>" to allow their deletion`)
+	assert.NotContains(t, admReview.Status.Result.Reason, "[services(1)]", "the bypass annotation should cover the other resources")
+	assert.Equal(t, []v1.StatusCause{{Type: causeTypeAddressRelease, Field: "external-address-services", Message: "web (LoadBalancer 203.0.113.10)"}},
+		admReview.Status.Result.Details.Causes)
+
+	testNamespace = cloneNamespace(testNamespace)
+	testNamespace.Annotations[addressBypassAnnotationKey] = "true"
+	clientset = fake.NewSimpleClientset(newLoadBalancer("web", "203.0.113.10"), testNamespace)
+
+	rw = httptest.NewRecorder()
+	req = httptest.NewRequest("POST", "http://localhost:8080/", constructPostBody(cloneAdmissionReview(templateAdmReview)))
+	webhookHandler(rw, req)
+	assert.False(t, getAdmissionReview(rw).Status.Allowed, "should reject if the address bypass annotation has no reason")
+
+	testNamespace = cloneNamespace(testNamespace)
+	testNamespace.Annotations[addressBypassReasonAnnotationKey] = "the DNS records moved to the new cluster"
+	clientset = fake.NewSimpleClientset(newLoadBalancer("web", "203.0.113.10"), testNamespace)
+
+	rw = httptest.NewRecorder()
+	req = httptest.NewRequest("POST", "http://localhost:8080/", constructPostBody(cloneAdmissionReview(templateAdmReview)))
+	webhookHandler(rw, req)
+	assert.True(t, getAdmissionReview(rw).Status.Allowed, "should approve if both bypass annotations are set")
+}
+
+func TestAddressBypassAnnotationWithoutBypass(t *testing.T) {
+	testNamespace := cloneNamespace(templateNamespace)
+	testNamespace.Annotations = map[string]string{addressBypassAnnotationKey: "true", addressBypassReasonAnnotationKey: "decommissioned"}
+	clientset = fake.NewSimpleClientset(newLoadBalancer("web", "203.0.113.10"), testNamespace)
+
+	rw := httptest.NewRecorder()
+	req := httptest.NewRequest("POST", "http://localhost:8080/", constructPostBody(cloneAdmissionReview(templateAdmReview)))
+	webhookHandler(rw, req)
+
+	admReview := getAdmissionReview(rw)
+	assert.False(t, admReview.Status.Allowed, "should still count the service")
+	assert.Contains(t, admReview.Status.Result.Reason, "[services(1)]")
+	assert.NotContains(t, admReview.Status.Result.Reason, "LoadBalancer", "should not flag the address release")
+}
+
+func TestAddressBypassRequireExpiry(t *testing.T) {
+	testPolicy := &policy{Bypass: bypassPolicy{RequireExpiry: true}}
+	assert.Nil(t, testPolicy.validate(false), "Error should be nil")
+	defer activePolicy.Store(currentPolicy())
+	activePolicy.Store(testPolicy)
+
+	annotations := map[string]string{
+		bypassAnnotationKey:              time.Now().Add(time.Hour).Format(time.RFC3339),
+		bypassReasonAnnotationKey:        "migrating to another cluster",
+		addressBypassAnnotationKey:       "true",
+		addressBypassReasonAnnotationKey: "the DNS records moved to the new cluster",
+	}
+	counters := riskCounters(annotations, true)
+	if assert.Len(t, counters, 1, "should not honor an address bypass that never expires") {
+		assert.Equal(t, "external-address-services", counters[0].kind)
+	}
+
+	annotations[addressBypassExpiresAnnotationKey] = time.Now().Add(time.Hour).Format(time.RFC3339)
+	assert.Empty(t, riskCounters(annotations, true), "should honor an address bypass that expires")
+
+	annotations[addressBypassExpiresAnnotationKey] = time.Now().Add(-time.Hour).Format(time.RFC3339)
+	assert.Len(t, riskCounters(annotations, true), 1, "should not honor an expired address bypass")
+}
+
+func TestAddressReleaseReason(t *testing.T) {
+	clientset = fake.NewSimpleClientset(newLoadBalancer("web", "203.0.113.10"))
+
+	_, _, _, err := countResources("test-namespace", []resourceCounter{addressCheck}, 0, nil)
+	if assert.IsType(t, &validationError{}, err) {
+		assert.Equal(t, reasonAddressRelease, err.(*validationError).reason)
+	}
+}
@@ -0,0 +1,142 @@
+// Copyright 2017 Yahoo Holdings Inc. 
+// Licensed under the terms of the 3-Clause BSD License.
+package main
+
+import (
+	"encoding/json"
+	"io"
+	"os"
+	"sync"
+	"time"
+
+	authenticationv1 "k8s.io/api/authentication/v1"
+	"k8s.io/apimachinery/pkg/types"
+
+	"gopkg.in/natefinch/lumberjack.v2"
+)
+
+// auditLog receives one record per admission decision, nothing is audited if it is nil
+var auditLog *auditSink
+
+// auditRecord is the forensic record of an admission decision
+type auditRecord struct {
+	Time       time.Time                 `json:"time"`
+	UID        types.UID                 `json:"uid"`
+	APIVersion string                    `json:"apiVersion"`
+	Operation  string                    `json:"operation"`
+	Resource   string                    `json:"resource"`
+	Namespace  string                    `json:"namespace"`
+	DryRun     bool                      `json:"dryRun,omitempty"`
+	User       authenticationv1.UserInfo `json:"user"`
+	Counts     map[string]int            `json:"resourceCounts,omitempty"`
+	Reason     string                    `json:"reason"`
+	Rule       string                    `json:"rule,omitempty"`
+	Allowed    bool                      `json:"allowed"`
+	Message    string                    `json:"message,omitempty"`
+	Warnings   []string                  `json:"warnings,omitempty"`
+	Duration   string                    `json:"duration,omitempty"`
+}
+
+// auditSink writes audit records as JSON lines. The writes are serialized so that records never interleave.
+type auditSink struct {
+	mu     sync.Mutex
+	writer io.Writer
+	// sync flushes the written record to disk, it is nil unless --auditLogFsync is set
+	sync func() error
+}
+
+// newAuditSink creates a sink appending to filename, rotated independently of the log file.
+// With fsync every record is flushed to disk before the verdict is returned.
+func newAuditSink(filename string, maxSize, maxBackups, maxAge int, fsync bool) *auditSink {
+	sink := &auditSink{
+		writer: &lumberjack.Logger{
+			Filename:   filename,
+			MaxSize:    maxSize, // Mb
+			MaxBackups: maxBackups,
+			MaxAge:     maxAge, // Days
+		},
+	}
+	if fsync {
+		sink.sync = (&fileSyncer{filename: filename}).sync
+	}
+	return sink
+}
+
+// fileSyncer flushes the file lumberjack writes to. lumberjack does not expose its file, but fsync on any
+// descriptor flushes the data of the file, so one is kept open until lumberjack rotates the file.
+type fileSyncer struct {
+	filename string
+	file     *os.File
+	info     os.FileInfo
+}
+
+// sync flushes the current file to disk, reopening it if it was rotated since the last record. The records
+// in a rotated file were all flushed when they were written.
+func (s *fileSyncer) sync() error {
+	if s.file != nil {
+		if info, err := os.Stat(s.filename); err == nil && os.SameFile(info, s.info) {
+			return s.file.Sync()
+		}
+		s.file.Close()
+		s.file = nil
+	}
+	file, err := os.Open(s.filename)
+	if err != nil {
+		return err
+	}
+	info, err := file.Stat()
+	if err != nil {
+		file.Close()
+		return err
+	}
+	s.file, s.info = file, info
+	return file.Sync()
+}
+
+// write appends record to the sink.
+func (s *auditSink) write(record *auditRecord) error {
+	data, err := json.Marshal(record)
+	if err != nil {
+		return err
+	}
+	data = append(data, '\n')
+
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	if _, err := s.writer.Write(data); err != nil {
+		return err
+	}
+	if s.sync != nil {
+		return s.sync()
+	}
+	return nil
+}
+
+// auditDecision writes the audit record of the verdict on review. Failures are logged, the verdict stands.
+func auditDecision(review *reviewRequest, allowed bool, errorMsg string) {
+	if auditLog == nil {
+		return
+	}
+	record := &auditRecord{
+		Time:       time.Now().UTC(),
+		UID:        review.UID,
+		APIVersion: review.apiVersion,
+		Operation:  string(review.Operation),
+		Resource:   review.Resource.Resource,
+		Namespace:  review.Name,
+		DryRun:     review.DryRun != nil && *review.DryRun,
+		User:       review.UserInfo,
+		Counts:     review.counts,
+		Reason:     review.reason,
+		Rule:       review.rule,
+		Allowed:    allowed,
+		Message:    errorMsg,
+		Warnings:   review.warnings,
+	}
+	if !review.start.IsZero() {
+		record.Duration = time.Since(review.start).String()
+	}
+	if err := auditLog.write(record); err != nil {
+		review.logger().WithError(err).Error("Failed to write the audit record")
+	}
+}
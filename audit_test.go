@@ -0,0 +1,97 @@
+// Copyright 2017 Yahoo Holdings Inc. 
+// Licensed under the terms of the 3-Clause BSD License.
+package main
+
+import (
+	"bytes"
+	"encoding/json"
+	"io/ioutil"
+	"net/http/httptest"
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+
+	corev1 "k8s.io/api/core/v1"
+	"k8s.io/apimachinery/pkg/apis/meta/v1"
+	"k8s.io/client-go/kubernetes/fake"
+
+	"github.com/stretchr/testify/assert"
+)
+
+func TestAuditDecisionWebhookHandler(t *testing.T) {
+	buf := &bytes.Buffer{}
+	defer func() { auditLog = nil }()
+	auditLog = &auditSink{writer: buf}
+
+	testPod := &corev1.Pod{
+		ObjectMeta: v1.ObjectMeta{
+			Name:      "test-pod",
+			Namespace: "test-namespace",
+		},
+	}
+	clientset = fake.NewSimpleClientset(testPod, cloneNamespace(templateNamespace))
+
+	testSpec := cloneAdmissionReview(templateAdmReview)
+	rw := httptest.NewRecorder()
+	req := httptest.NewRequest("POST", "http://localhost:8080/", constructPostBody(testSpec))
+	webhookHandler(rw, req)
+
+	lines := strings.Split(strings.TrimSpace(buf.String()), "\n")
+	assert.Len(t, lines, 1, "should write one record per decision")
+
+	record := auditRecord{}
+	assert.Nil(t, json.Unmarshal([]byte(lines[0]), &record), "should write the record as JSON")
+	assert.Equal(t, "DELETE", record.Operation)
+	assert.Equal(t, "namespaces", record.Resource)
+	assert.Equal(t, "test-namespace", record.Namespace)
+	assert.Equal(t, testSpec.Spec.UserInfo.Username, record.User.Username)
+	assert.Equal(t, 1, record.Counts["pods"])
+	assert.Equal(t, 0, record.Counts["services"])
+	assert.Equal(t, reasonNotEmpty, record.Reason)
+	assert.Equal(t, "thresholds exceeded: pods(1) > 0", record.Rule)
+	assert.False(t, record.Allowed)
+	assert.Contains(t, record.Message, "[pods(1)]")
+	assert.NotEmpty(t, record.Duration)
+}
+
+func TestAuditSinkFile(t *testing.T) {
+	dir, err := ioutil.TempDir("", "audit")
+	assert.Nil(t, err, "Error should be nil")
+	defer os.RemoveAll(dir)
+
+	filename := filepath.Join(dir, "audit.log")
+	sink := newAuditSink(filename, 1, 1, 1, true)
+	assert.Nil(t, sink.write(&auditRecord{Namespace: "test-namespace", Reason: reasonBypass, Allowed: true}), "Error should be nil")
+	assert.Nil(t, sink.write(&auditRecord{Namespace: "other-namespace", Reason: reasonEmpty, Allowed: true}), "Error should be nil")
+
+	data, err := ioutil.ReadFile(filename)
+	assert.Nil(t, err, "Error should be nil")
+	lines := strings.Split(strings.TrimSpace(string(data)), "\n")
+	if assert.Len(t, lines, 2, "should append one line per record") {
+		assert.Contains(t, lines[0], `"namespace":"test-namespace"`)
+		assert.Contains(t, lines[1], `"namespace":"other-namespace"`)
+	}
+}
+
+func TestFileSyncerRotation(t *testing.T) {
+	dir, err := ioutil.TempDir("", "audit")
+	assert.Nil(t, err, "Error should be nil")
+	defer os.RemoveAll(dir)
+
+	filename := filepath.Join(dir, "audit.log")
+	assert.Nil(t, ioutil.WriteFile(filename, []byte("{}\n"), 0644), "Error should be nil")
+	syncer := &fileSyncer{filename: filename}
+	assert.Nil(t, syncer.sync(), "Error should be nil")
+	opened := syncer.file
+	assert.Nil(t, syncer.sync(), "Error should be nil")
+	assert.Equal(t, opened, syncer.file, "should keep the file open between records")
+
+	assert.Nil(t, os.Rename(filename, filepath.Join(dir, "audit-rotated.log")), "Error should be nil")
+	assert.Nil(t, ioutil.WriteFile(filename, []byte("{}\n"), 0644), "Error should be nil")
+	assert.Nil(t, syncer.sync(), "Error should be nil")
+	info, err := os.Stat(filename)
+	assert.Nil(t, err, "Error should be nil")
+	assert.True(t, os.SameFile(info, syncer.info), "should reopen the file once it is rotated")
+	syncer.file.Close()
+}
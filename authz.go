@@ -0,0 +1,172 @@
+// Copyright 2017 Yahoo Holdings Inc. 
+// Licensed under the terms of the 3-Clause BSD License.
+package main
+
+import (
+	"encoding/json"
+	"errors"
+	"fmt"
+	"strings"
+
+	"github.com/Sirupsen/logrus"
+	authenticationv1 "k8s.io/api/authentication/v1"
+	authorizationv1 "k8s.io/api/authorization/v1"
+	"k8s.io/apimachinery/pkg/apis/meta/v1"
+	"k8s.io/apimachinery/pkg/labels"
+	"k8s.io/apimachinery/pkg/runtime"
+)
+
+// activeBypassPermission is the permission required to set the bypass annotation, nil if anyone may set it
+var activeBypassPermission *bypassPermission
+
+// bypassGrantingAnnotationKeys are the annotations that grant or extend a bypass. Removing them, or changing
+// the reason, only narrows the bypass and does not require the bypass permission.
+var bypassGrantingAnnotationKeys = []string{bypassAnnotationKey, bypassExpiresAnnotationKey, addressBypassAnnotationKey, addressBypassExpiresAnnotationKey}
+
+// objectMeta is the metadata of a namespace embedded in an AdmissionReview
+type objectMeta struct {
+	v1.ObjectMeta `json:"metadata,omitempty"`
+}
+
+// metadataOf decodes the metadata of a namespace embedded in an AdmissionReview. An empty object,
+// e.g. the old object of a CREATE, has no annotations nor labels.
+func metadataOf(object runtime.RawExtension) (v1.ObjectMeta, error) {
+	meta := objectMeta{}
+	if len(object.Raw) == 0 {
+		return meta.ObjectMeta, nil
+	}
+	if err := json.Unmarshal(object.Raw, &meta); err != nil {
+		return meta.ObjectMeta, err
+	}
+	return meta.ObjectMeta, nil
+}
+
+// guardedChanges returns what the change from oldObject to object does that requires the bypass permission:
+// adding or changing a bypass granting annotation, setting the mode label so that the namespace is no longer
+// enforced, or changing the labels so that the namespace no longer matches the protected selector.
+func guardedChanges(oldObject, object runtime.RawExtension) ([]string, error) {
+	oldMeta, err := metadataOf(oldObject)
+	if err != nil {
+		return nil, fmt.Errorf("error decoding the old namespace, %v", err)
+	}
+	meta, err := metadataOf(object)
+	if err != nil {
+		return nil, fmt.Errorf("error decoding the namespace, %v", err)
+	}
+
+	var changed []string
+	for _, key := range bypassGrantingAnnotationKeys {
+		value, ok := meta.Annotations[key]
+		if !ok {
+			continue
+		}
+		if oldValue, ok := oldMeta.Annotations[key]; !ok || oldValue != value {
+			changed = append(changed, "annotation "+key)
+		}
+	}
+
+	oldMode, oldSet := oldMeta.Labels[modeLabelKey]
+	mode, set := meta.Labels[modeLabelKey]
+	if (set != oldSet || mode != oldMode) && namespaceMode(meta.Name, meta.Labels) != modeEnforce {
+		changed = append(changed, "label "+modeLabelKey)
+	}
+
+	protected := currentPolicy().Protected
+	if protected.selector != nil && protected.selector.Matches(labels.Set(oldMeta.Labels)) && !protected.selector.Matches(labels.Set(meta.Labels)) {
+		changed = append(changed, fmt.Sprintf("labels matching the protected selector %s", protected.Selector))
+	}
+	return changed, nil
+}
+
+// bypassPermission is the virtual verb on a namespace subresource a user needs to set the bypass annotation
+type bypassPermission struct {
+	verb        string
+	resource    string
+	subresource string
+}
+
+func (p bypassPermission) String() string {
+	if p.subresource == "" {
+		return fmt.Sprintf("%s on %s", p.verb, p.resource)
+	}
+	return fmt.Sprintf("%s on %s/%s", p.verb, p.resource, p.subresource)
+}
+
+// parseBypassPermission parses the --bypassVerb and --bypassResource flags, e.g. "bypass" and "namespaces/guard".
+// An empty verb disables the check.
+func parseBypassPermission(verb, resource string) (*bypassPermission, error) {
+	verb = strings.TrimSpace(verb)
+	if verb == "" {
+		return nil, nil
+	}
+	parts := strings.Split(strings.TrimSpace(resource), "/")
+	if len(parts) > 2 || parts[0] == "" || (len(parts) == 2 && parts[1] == "") {
+		return nil, fmt.Errorf("invalid resource %q, expected resource or resource/subresource", resource)
+	}
+	p := &bypassPermission{verb: verb, resource: parts[0]}
+	if len(parts) == 2 {
+		p.subresource = parts[1]
+	}
+	return p, nil
+}
+
+// authorize asks the apiserver through a SubjectAccessReview whether user holds the permission on the namespace.
+// reason is the explanation of the authorizer, if any.
+func (p *bypassPermission) authorize(user authenticationv1.UserInfo, namespace string) (allowed bool, reason string, err error) {
+	extra := map[string]authorizationv1.ExtraValue{}
+	for key, value := range user.Extra {
+		extra[key] = authorizationv1.ExtraValue(value)
+	}
+	sar := &authorizationv1.SubjectAccessReview{
+		Spec: authorizationv1.SubjectAccessReviewSpec{
+			ResourceAttributes: &authorizationv1.ResourceAttributes{
+				Verb:        p.verb,
+				Group:       "",
+				Resource:    p.resource,
+				Subresource: p.subresource,
+				Name:        namespace,
+			},
+			User:   user.Username,
+			UID:    user.UID,
+			Groups: user.Groups,
+			Extra:  extra,
+		},
+	}
+	result, err := clientset.AuthorizationV1().SubjectAccessReviews().Create(sar)
+	if err != nil {
+		return false, "", err
+	}
+	return result.Status.Allowed, result.Status.Reason, nil
+}
+
+// validateNamespaceChange returns an error if the CREATE or UPDATE of a namespace makes a guarded change,
+// such as adding the bypass annotation, and the user does not hold the bypass permission.
+func validateNamespaceChange(review *reviewRequest) error {
+	if activeBypassPermission == nil {
+		return nil
+	}
+	changed, err := guardedChanges(review.OldObject, review.Object)
+	if err != nil {
+		return fmt.Errorf("Error occurred while comparing the metadata of the namespace %s: %s", review.Name, err.Error())
+	}
+	if len(changed) == 0 {
+		return nil
+	}
+
+	allowed, reason, err := activeBypassPermission.authorize(review.UserInfo, review.Name)
+	if err != nil {
+		return fmt.Errorf("Error occurred while authorizing user %s to change %s on the namespace %s: %s", review.UserInfo.Username, strings.Join(changed, ", "), review.Name, err.Error())
+	}
+	if !allowed {
+		errStr := fmt.Sprintf("User %s is not allowed to change %s on the namespace %s, this requires the %s permission.", review.UserInfo.Username, strings.Join(changed, ", "), review.Name, activeBypassPermission)
+		if reason != "" {
+			errStr += fmt.Sprintf(" Reason: %s.", reason)
+		}
+		return errors.New(errStr)
+	}
+	review.logger().WithFields(logrus.Fields{
+		"changed":    changed,
+		"permission": activeBypassPermission.String(),
+	}).Info("User holds the bypass permission. OK to make the guarded changes.")
+	return nil
+}
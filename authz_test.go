@@ -0,0 +1,215 @@
+// Copyright 2017 Yahoo Holdings Inc. 
+// Licensed under the terms of the 3-Clause BSD License.
+package main
+
+import (
+	"fmt"
+	"net/http/httptest"
+	"os"
+	"testing"
+
+	admissionv1beta1 "k8s.io/api/admission/v1beta1"
+	authenticationv1 "k8s.io/api/authentication/v1"
+	authorizationv1 "k8s.io/api/authorization/v1"
+	"k8s.io/apimachinery/pkg/runtime"
+	"k8s.io/client-go/kubernetes/fake"
+	clienttesting "k8s.io/client-go/testing"
+
+	"github.com/stretchr/testify/assert"
+)
+
+func namespaceObject(annotations string) runtime.RawExtension {
+	return runtime.RawExtension{
+		Raw: []byte(fmt.Sprintf(`{"apiVersion":"v1","kind":"Namespace","metadata":{"name":"test-namespace","annotations":%s}}`, annotations)),
+	}
+}
+
+func labeledNamespaceObject(labels string) runtime.RawExtension {
+	return runtime.RawExtension{
+		Raw: []byte(fmt.Sprintf(`{"apiVersion":"v1","kind":"Namespace","metadata":{"name":"test-namespace","labels":%s}}`, labels)),
+	}
+}
+
+// fakeAuthorizer answers every SubjectAccessReview with allowed and records the last one
+func fakeAuthorizer(allowed bool, lastReview **authorizationv1.SubjectAccessReview) *fake.Clientset {
+	fakeClientset := fake.NewSimpleClientset(cloneNamespace(templateNamespace))
+	fakeClientset.PrependReactor("create", "subjectaccessreviews", func(action clienttesting.Action) (bool, runtime.Object, error) {
+		sar := action.(clienttesting.CreateAction).GetObject().(*authorizationv1.SubjectAccessReview)
+		*lastReview = sar
+		sar.Status.Allowed = allowed
+		if !allowed {
+			sar.Status.Reason = "no RBAC policy matched"
+		}
+		return true, sar, nil
+	})
+	return fakeClientset
+}
+
+func updateReview(oldAnnotations, annotations string) *legacyAdmissionReview {
+	testSpec := cloneAdmissionReview(templateAdmReview)
+	testSpec.Spec.Operation = admissionv1beta1.Update
+	testSpec.Spec.OldObject = namespaceObject(oldAnnotations)
+	testSpec.Spec.Object = namespaceObject(annotations)
+	testSpec.Spec.UserInfo = authenticationv1.UserInfo{
+		Username: "jane",
+		Groups:   []string{"developers"},
+		Extra:    map[string]authenticationv1.ExtraValue{"scopes": {"all"}},
+	}
+	return testSpec
+}
+
+func TestParseBypassPermission(t *testing.T) {
+	permission, err := parseBypassPermission("bypass", "namespaces/guard")
+	assert.Nil(t, err, "Error should be nil")
+	assert.Equal(t, &bypassPermission{verb: "bypass", resource: "namespaces", subresource: "guard"}, permission)
+	assert.Equal(t, "bypass on namespaces/guard", permission.String())
+
+	permission, err = parseBypassPermission("", "namespaces/guard")
+	assert.Nil(t, err, "Error should be nil")
+	assert.Nil(t, permission, "an empty verb should disable the check")
+
+	for _, resource := range []string{"", "/guard", "namespaces/", "namespaces/guard/extra"} {
+		_, err = parseBypassPermission("bypass", resource)
+		assert.NotNil(t, err, "should reject the resource %q", resource)
+	}
+}
+
+func TestGuardedChanges(t *testing.T) {
+	changed, err := guardedChanges(namespaceObject(`{}`), namespaceObject(`{"owner":"jane"}`))
+	assert.Nil(t, err, "Error should be nil")
+	assert.Empty(t, changed, "unrelated annotations should not require the bypass permission")
+
+	changed, _ = guardedChanges(namespaceObject(`{}`),
+		namespaceObject(fmt.Sprintf(`{%q:"true",%q:"cleanup"}`, bypassAnnotationKey, bypassReasonAnnotationKey)))
+	assert.Equal(t, []string{"annotation " + bypassAnnotationKey}, changed)
+
+	changed, _ = guardedChanges(namespaceObject(fmt.Sprintf(`{%q:"true"}`, bypassAnnotationKey)),
+		namespaceObject(fmt.Sprintf(`{%q:"true",%q:"2017-10-02T00:00:00Z"}`, bypassAnnotationKey, bypassExpiresAnnotationKey)))
+	assert.Equal(t, []string{"annotation " + bypassExpiresAnnotationKey}, changed)
+
+	changed, _ = guardedChanges(namespaceObject(fmt.Sprintf(`{%q:"true",%q:"cleanup"}`, bypassAnnotationKey, bypassReasonAnnotationKey)),
+		namespaceObject(fmt.Sprintf(`{%q:"true",%q:"decommissioning"}`, bypassAnnotationKey, bypassReasonAnnotationKey)))
+	assert.Empty(t, changed, "changing the reason should not require the bypass permission")
+
+	changed, _ = guardedChanges(namespaceObject(fmt.Sprintf(`{%q:"true"}`, bypassAnnotationKey)), namespaceObject(`{}`))
+	assert.Empty(t, changed, "removing the bypass annotation should not require the bypass permission")
+
+	_, err = guardedChanges(runtime.RawExtension{Raw: []byte("{")}, namespaceObject(`{}`))
+	assert.NotNil(t, err, "should fail on an undecodable object")
+}
+
+func TestGuardedLabelChanges(t *testing.T) {
+	filename := writePolicyFile("protectedNamespaces:\n  selector: guard.yahoo.com/protected=true\n")
+	defer os.Remove(filename)
+	testPolicy, err := loadPolicy(filename, false)
+	assert.Nil(t, err, "Error should be nil")
+	defer activePolicy.Store(currentPolicy())
+	activePolicy.Store(testPolicy)
+
+	changed, err := guardedChanges(labeledNamespaceObject(`{}`), labeledNamespaceObject(fmt.Sprintf(`{%q:"off"}`, modeLabelKey)))
+	assert.Nil(t, err, "Error should be nil")
+	assert.Equal(t, []string{"label " + modeLabelKey}, changed, "turning the enforcement off should require the bypass permission")
+
+	changed, _ = guardedChanges(labeledNamespaceObject(fmt.Sprintf(`{%q:"off"}`, modeLabelKey)), labeledNamespaceObject(fmt.Sprintf(`{%q:"enforce"}`, modeLabelKey)))
+	assert.Empty(t, changed, "enforcing the namespace should not require the bypass permission")
+
+	changed, _ = guardedChanges(labeledNamespaceObject(fmt.Sprintf(`{%q:"off"}`, modeLabelKey)), labeledNamespaceObject(`{}`))
+	assert.Empty(t, changed, "falling back to the enforced cluster-wide mode should not require the bypass permission")
+
+	changed, _ = guardedChanges(labeledNamespaceObject(`{"guard.yahoo.com/protected":"true"}`), labeledNamespaceObject(`{"owner":"jane"}`))
+	assert.Equal(t, []string{"labels matching the protected selector guard.yahoo.com/protected=true"}, changed)
+
+	changed, _ = guardedChanges(labeledNamespaceObject(`{"guard.yahoo.com/protected":"true"}`), labeledNamespaceObject(`{"guard.yahoo.com/protected":"true","owner":"jane"}`))
+	assert.Empty(t, changed, "changes keeping the namespace protected should not require the bypass permission")
+}
+
+func TestAuthorizedBypassUpdateWebhookHandler(t *testing.T) {
+	defer func(permission *bypassPermission) { activeBypassPermission = permission }(activeBypassPermission)
+	activeBypassPermission = &bypassPermission{verb: "bypass", resource: "namespaces", subresource: "guard"}
+
+	var sar *authorizationv1.SubjectAccessReview
+	clientset = fakeAuthorizer(true, &sar)
+
+	rw := httptest.NewRecorder()
+	req := httptest.NewRequest("POST", "http://localhost:8080/", constructPostBody(updateReview(`{}`, fmt.Sprintf(`{%q:"true"}`, bypassAnnotationKey))))
+	webhookHandler(rw, req)
+
+	assert.True(t, getAdmissionReview(rw).Status.Allowed, "should approve if the user holds the bypass permission")
+	if assert.NotNil(t, sar, "should create a SubjectAccessReview") {
+		assert.Equal(t, &authorizationv1.ResourceAttributes{Verb: "bypass", Resource: "namespaces", Subresource: "guard", Name: "test-namespace"}, sar.Spec.ResourceAttributes)
+		assert.Equal(t, "jane", sar.Spec.User)
+		assert.Equal(t, []string{"developers"}, sar.Spec.Groups)
+		assert.Equal(t, map[string]authorizationv1.ExtraValue{"scopes": {"all"}}, sar.Spec.Extra)
+	}
+}
+
+func TestUnauthorizedBypassUpdateWebhookHandler(t *testing.T) {
+	defer func(permission *bypassPermission) { activeBypassPermission = permission }(activeBypassPermission)
+	activeBypassPermission = &bypassPermission{verb: "bypass", resource: "namespaces", subresource: "guard"}
+
+	var sar *authorizationv1.SubjectAccessReview
+	clientset = fakeAuthorizer(false, &sar)
+
+	rw := httptest.NewRecorder()
+	req := httptest.NewRequest("POST", "http://localhost:8080/", constructPostBody(updateReview(`{}`, fmt.Sprintf(`{%q:"true"}`, bypassAnnotationKey))))
+	webhookHandler(rw, req)
+
+	admReview := getAdmissionReview(rw)
+	assert.False(t, admReview.Status.Allowed, "should reject if the user does not hold the bypass permission")
+	assert.Contains(t, admReview.Status.Result.Reason, fmt.Sprintf("User jane is not allowed to change annotation %s on the namespace test-namespace, this requires the bypass on namespaces/guard permission. Reason: no RBAC policy matched.", bypassAnnotationKey))
+}
+
+func TestUnrelatedUpdateWebhookHandler(t *testing.T) {
+	defer func(permission *bypassPermission) { activeBypassPermission = permission }(activeBypassPermission)
+	activeBypassPermission = &bypassPermission{verb: "bypass", resource: "namespaces", subresource: "guard"}
+
+	var sar *authorizationv1.SubjectAccessReview
+	clientset = fakeAuthorizer(false, &sar)
+
+	rw := httptest.NewRecorder()
+	req := httptest.NewRequest("POST", "http://localhost:8080/", constructPostBody(updateReview(`{}`, `{"owner":"jane"}`)))
+	webhookHandler(rw, req)
+
+	assert.True(t, getAdmissionReview(rw).Status.Allowed, "should approve updates that leave the bypass annotation alone")
+	assert.Nil(t, sar, "should not create a SubjectAccessReview")
+}
+
+func TestDisabledBypassPermissionWebhookHandler(t *testing.T) {
+	defer func(permission *bypassPermission) { activeBypassPermission = permission }(activeBypassPermission)
+	activeBypassPermission = nil
+
+	var sar *authorizationv1.SubjectAccessReview
+	clientset = fakeAuthorizer(false, &sar)
+
+	rw := httptest.NewRecorder()
+	req := httptest.NewRequest("POST", "http://localhost:8080/", constructPostBody(updateReview(`{}`, fmt.Sprintf(`{%q:"true"}`, bypassAnnotationKey))))
+	webhookHandler(rw, req)
+
+	assert.True(t, getAdmissionReview(rw).Status.Allowed, "should approve if the bypass permission check is disabled")
+	assert.Nil(t, sar, "should not create a SubjectAccessReview")
+}
+
+func TestUnauthorizedBypassCreateWebhookHandler(t *testing.T) {
+	defer func(permission *bypassPermission) { activeBypassPermission = permission }(activeBypassPermission)
+	activeBypassPermission = &bypassPermission{verb: "bypass", resource: "namespaces", subresource: "guard"}
+
+	var sar *authorizationv1.SubjectAccessReview
+	clientset = fakeAuthorizer(false, &sar)
+
+	testSpec := updateReview(`{}`, fmt.Sprintf(`{%q:"true"}`, bypassAnnotationKey))
+	testSpec.Spec.Operation = admissionv1beta1.Create
+	testSpec.Spec.OldObject = runtime.RawExtension{}
+	rw := httptest.NewRecorder()
+	req := httptest.NewRequest("POST", "http://localhost:8080/", constructPostBody(testSpec))
+	webhookHandler(rw, req)
+
+	admReview := getAdmissionReview(rw)
+	assert.False(t, admReview.Status.Allowed, "should reject the creation of a bypass annotated namespace if the user does not hold the bypass permission")
+	assert.Contains(t, admReview.Status.Result.Reason, fmt.Sprintf("User jane is not allowed to change annotation %s on the namespace test-namespace", bypassAnnotationKey))
+
+	testSpec.Spec.Object = namespaceObject(`{"owner":"jane"}`)
+	rw = httptest.NewRecorder()
+	req = httptest.NewRequest("POST", "http://localhost:8080/", constructPostBody(testSpec))
+	webhookHandler(rw, req)
+	assert.True(t, getAdmissionReview(rw).Status.Allowed, "should approve the creation of a namespace without guarded metadata")
+}
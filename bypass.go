@@ -0,0 +1,91 @@
+// Copyright 2017 Yahoo Holdings Inc. 
+// Licensed under the terms of the 3-Clause BSD License.
+package main
+
+import (
+	"fmt"
+	"strings"
+	"time"
+)
+
+const (
+	// bypassExpiresAnnotationKey optionally holds the RFC3339 expiry of the bypass annotation
+	bypassExpiresAnnotationKey = bypassAnnotationKey + "-expires"
+	// bypassReasonAnnotationKey holds the justification that is required for the bypass annotation to be honored
+	bypassReasonAnnotationKey = bypassAnnotationKey + "-reason"
+)
+
+// bypassPolicy configures what it takes for the bypass annotation to be honored
+type bypassPolicy struct {
+	// RequireExpiry refuses bypass annotations that never expire
+	RequireExpiry bool `json:"requireExpiry,omitempty"`
+}
+
+// bypass is the bypass of the policy check requested through the namespace annotations
+type bypass struct {
+	expires *time.Time
+	reason  string
+}
+
+func (b bypass) String() string {
+	if b.expires == nil {
+		return "never expires"
+	}
+	return "expires " + b.expires.Format(time.RFC3339)
+}
+
+// bypassAnnotations are the annotations requesting a bypass: key set to true or to an RFC3339 expiry, the
+// optional separate expiry in expiresKey and the justification in reasonKey.
+type bypassAnnotations struct {
+	key        string
+	expiresKey string
+	reasonKey  string
+}
+
+// cascadeBypass are the annotations of the bypass annotation, which skips the validation of a deletion
+var cascadeBypass = bypassAnnotations{key: bypassAnnotationKey, expiresKey: bypassExpiresAnnotationKey, reasonKey: bypassReasonAnnotationKey}
+
+// parseBypass returns the bypass requested through the bypass annotation, see bypassAnnotations.parse.
+func parseBypass(annotations map[string]string, now time.Time, requireExpiry bool) (b bypass, requested bool, err error) {
+	return cascadeBypass.parse(annotations, now, requireExpiry)
+}
+
+// parse returns the bypass requested through the annotations. requested is false if the key annotation
+// is not set to true or to an RFC3339 expiry, and err explains why a requested bypass is not honored.
+func (a bypassAnnotations) parse(annotations map[string]string, now time.Time, requireExpiry bool) (b bypass, requested bool, err error) {
+	value, ok := annotations[a.key]
+	if !ok || value == "false" {
+		return b, false, nil
+	}
+
+	if value != "true" {
+		expires, err := time.Parse(time.RFC3339, value)
+		if err != nil {
+			return b, true, fmt.Errorf("%s=%s is neither true nor an RFC3339 expiry", a.key, value)
+		}
+		b.expires = &expires
+	}
+	if value, ok := annotations[a.expiresKey]; ok {
+		expires, err := time.Parse(time.RFC3339, value)
+		if err != nil {
+			return b, true, fmt.Errorf("%s=%s is not an RFC3339 expiry", a.expiresKey, value)
+		}
+		// honor the earliest of both expiries
+		if b.expires == nil || expires.Before(*b.expires) {
+			b.expires = &expires
+		}
+	}
+
+	if b.expires == nil && requireExpiry {
+		return b, true, fmt.Errorf("it has no expiry, set %s to an RFC3339 timestamp", a.key)
+	}
+	if b.expires != nil && now.After(*b.expires) {
+		return b, true, fmt.Errorf("it expired at %s", b.expires.Format(time.RFC3339))
+	}
+
+	b.reason = strings.TrimSpace(annotations[a.reasonKey])
+	if b.reason == "" {
+		return b, true, fmt.Errorf("it has no justification, set %s to the reason for the deletion", a.reasonKey)
+	}
+	return b, true, nil
+}
@@ -0,0 +1,151 @@
+// Copyright 2017 Yahoo Holdings Inc. 
+// Licensed under the terms of the 3-Clause BSD License.
+package main
+
+import (
+	"net/http/httptest"
+	"testing"
+	"time"
+
+	corev1 "k8s.io/api/core/v1"
+	"k8s.io/apimachinery/pkg/apis/meta/v1"
+	"k8s.io/client-go/kubernetes/fake"
+
+	"github.com/stretchr/testify/assert"
+)
+
+var testNow = time.Date(2017, 10, 1, 12, 0, 0, 0, time.UTC)
+
+func TestParseBypass(t *testing.T) {
+	_, requested, err := parseBypass(nil, testNow, false)
+	assert.False(t, requested, "no bypass should be requested without the annotation")
+	assert.Nil(t, err, "Error should be nil")
+
+	_, requested, _ = parseBypass(map[string]string{bypassAnnotationKey: "false"}, testNow, false)
+	assert.False(t, requested, "no bypass should be requested if the annotation is false")
+
+	b, requested, err := parseBypass(map[string]string{
+		bypassAnnotationKey:       "true",
+		bypassReasonAnnotationKey: " migrating to another cluster ",
+	}, testNow, false)
+	assert.True(t, requested)
+	assert.Nil(t, err, "Error should be nil")
+	assert.Nil(t, b.expires, "should never expire")
+	assert.Equal(t, "migrating to another cluster", b.reason)
+
+	b, _, err = parseBypass(map[string]string{
+		bypassAnnotationKey:       "2017-10-02T00:00:00Z",
+		bypassReasonAnnotationKey: "migrating to another cluster",
+	}, testNow, true)
+	assert.Nil(t, err, "Error should be nil")
+	assert.Equal(t, "expires 2017-10-02T00:00:00Z", b.String())
+
+	b, _, err = parseBypass(map[string]string{
+		bypassAnnotationKey:        "2017-10-02T00:00:00Z",
+		bypassExpiresAnnotationKey: "2017-10-01T18:00:00Z",
+		bypassReasonAnnotationKey:  "migrating to another cluster",
+	}, testNow, false)
+	assert.Nil(t, err, "Error should be nil")
+	assert.Equal(t, "expires 2017-10-01T18:00:00Z", b.String(), "the earliest expiry should be honored")
+}
+
+func TestRefusedBypass(t *testing.T) {
+	refusedBypasses := []struct {
+		annotations   map[string]string
+		requireExpiry bool
+		errorMsg      string
+	}{
+		{map[string]string{bypassAnnotationKey: "yes", bypassReasonAnnotationKey: "cleanup"}, false, "is neither true nor an RFC3339 expiry"},
+		{map[string]string{bypassAnnotationKey: "true", bypassExpiresAnnotationKey: "tomorrow", bypassReasonAnnotationKey: "cleanup"}, false, "is not an RFC3339 expiry"},
+		{map[string]string{bypassAnnotationKey: "2017-10-01T00:00:00Z", bypassReasonAnnotationKey: "cleanup"}, false, "it expired at 2017-10-01T00:00:00Z"},
+		{map[string]string{bypassAnnotationKey: "true", bypassExpiresAnnotationKey: "2017-09-30T00:00:00Z", bypassReasonAnnotationKey: "cleanup"}, false, "it expired at 2017-09-30T00:00:00Z"},
+		{map[string]string{bypassAnnotationKey: "true", bypassReasonAnnotationKey: "cleanup"}, true, "it has no expiry"},
+		{map[string]string{bypassAnnotationKey: "true"}, false, "it has no justification"},
+		{map[string]string{bypassAnnotationKey: "true", bypassReasonAnnotationKey: "  "}, false, "it has no justification"},
+	}
+
+	for _, refused := range refusedBypasses {
+		_, requested, err := parseBypass(refused.annotations, testNow, refused.requireExpiry)
+		assert.True(t, requested, "bypass should be requested for %v", refused.annotations)
+		assert.NotNil(t, err, "bypass should be refused for %v", refused.annotations)
+		if err != nil {
+			assert.Contains(t, err.Error(), refused.errorMsg)
+		}
+	}
+}
+
+func TestExpiredBypassWebhookHandler(t *testing.T) {
+	testPod := &corev1.Pod{
+		ObjectMeta: v1.ObjectMeta{
+			Name:      "test-pod",
+			Namespace: "test-namespace",
+		},
+	}
+	testNamespace := cloneNamespace(templateNamespace)
+	testNamespace.Annotations = map[string]string{
+		bypassAnnotationKey:       "2017-10-01T00:00:00Z",
+		bypassReasonAnnotationKey: "decommissioning test-namespace",
+	}
+	clientset = fake.NewSimpleClientset(testPod, testNamespace)
+
+	rw := httptest.NewRecorder()
+	req := httptest.NewRequest("POST", "http://localhost:8080/", constructPostBody(cloneAdmissionReview(templateAdmReview)))
+	webhookHandler(rw, req)
+
+	admReview := getAdmissionReview(rw)
+	assert.False(t, admReview.Status.Allowed, "should reject if the bypass annotation expired")
+	assert.Contains(t, admReview.Status.Result.Reason, "The bypass annotation is not honored because it expired at 2017-10-01T00:00:00Z.")
+}
+
+func TestUnjustifiedBypassWebhookHandler(t *testing.T) {
+	testPod := &corev1.Pod{
+		ObjectMeta: v1.ObjectMeta{
+			Name:      "test-pod",
+			Namespace: "test-namespace",
+		},
+	}
+	testNamespace := cloneNamespace(templateNamespace)
+	testNamespace.Annotations = map[string]string{bypassAnnotationKey: "true"}
+	clientset = fake.NewSimpleClientset(testPod, testNamespace)
+
+	rw := httptest.NewRecorder()
+	req := httptest.NewRequest("POST", "http://localhost:8080/", constructPostBody(cloneAdmissionReview(templateAdmReview)))
+	webhookHandler(rw, req)
+
+	admReview := getAdmissionReview(rw)
+	assert.False(t, admReview.Status.Allowed, "should reject if the bypass annotation has no reason")
+	assert.Contains(t, admReview.Status.Result.Reason, "The bypass annotation is not honored because it has no justification")
+}
+
+func TestUnjustifiedBypassEmptyNamespaceWebhookHandler(t *testing.T) {
+	testNamespace := cloneNamespace(templateNamespace)
+	testNamespace.Annotations = map[string]string{bypassAnnotationKey: "true"}
+	clientset = fake.NewSimpleClientset(testNamespace)
+
+	rw := httptest.NewRecorder()
+	req := httptest.NewRequest("POST", "http://localhost:8080/", constructPostBody(cloneAdmissionReview(templateAdmReview)))
+	webhookHandler(rw, req)
+
+	assert.True(t, getAdmissionReview(rw).Status.Allowed, "should approve an empty namespace even if its bypass annotation is refused")
+}
+
+func TestFutureBypassWebhookHandler(t *testing.T) {
+	testPod := &corev1.Pod{
+		ObjectMeta: v1.ObjectMeta{
+			Name:      "test-pod",
+			Namespace: "test-namespace",
+		},
+	}
+	testNamespace := cloneNamespace(templateNamespace)
+	testNamespace.Annotations = map[string]string{
+		bypassAnnotationKey:       time.Now().Add(time.Hour).UTC().Format(time.RFC3339),
+		bypassReasonAnnotationKey: "decommissioning test-namespace",
+	}
+	clientset = fake.NewSimpleClientset(testPod, testNamespace)
+
+	rw := httptest.NewRecorder()
+	req := httptest.NewRequest("POST", "http://localhost:8080/", constructPostBody(cloneAdmissionReview(templateAdmReview)))
+	webhookHandler(rw, req)
+
+	assert.True(t, getAdmissionReview(rw).Status.Allowed, "should approve if the bypass annotation has not expired yet")
+}
@@ -0,0 +1,197 @@
+// Copyright 2017 Yahoo Holdings Inc. 
+// Licensed under the terms of the 3-Clause BSD License.
+package main
+
+import (
+	"fmt"
+	"sync"
+	"sync/atomic"
+	"time"
+
+	"k8s.io/apimachinery/pkg/api/meta"
+	"k8s.io/apimachinery/pkg/apis/meta/v1"
+	"k8s.io/apimachinery/pkg/labels"
+	"k8s.io/apimachinery/pkg/runtime"
+	"k8s.io/apimachinery/pkg/runtime/schema"
+	"k8s.io/client-go/dynamic/dynamicinformer"
+	"k8s.io/client-go/informers"
+	"k8s.io/client-go/tools/cache"
+)
+
+// resourceCache answers resource counts from shared informer caches instead of listing from the apiserver.
+// Informers are started lazily for every resource type that is counted, so resource types found in
+// discovery mode are picked up as they appear.
+type resourceCache struct {
+	factory        informers.SharedInformerFactory
+	dynamicFactory dynamicinformer.DynamicSharedInformerFactory
+	maxStaleness   time.Duration
+	stopCh         <-chan struct{}
+	synced         int32
+
+	mu        sync.Mutex
+	informers map[schema.GroupVersionResource]*cachedInformer
+}
+
+// cachedInformer is an informer along with the time it last observed a change.
+type cachedInformer struct {
+	informers.GenericInformer
+	lastEvent int64
+}
+
+func (c *cachedInformer) touch(obj interface{}) {
+	atomic.StoreInt64(&c.lastEvent, time.Now().UnixNano())
+}
+
+// touchChanged records an update unless it is a resync, which replays the cached object as is and
+// would keep the cache of a broken watch looking fresh.
+func (c *cachedInformer) touchChanged(oldObj, newObj interface{}) {
+	oldMeta, err := meta.Accessor(oldObj)
+	if err != nil {
+		c.touch(newObj)
+		return
+	}
+	newMeta, err := meta.Accessor(newObj)
+	if err != nil || oldMeta.GetResourceVersion() == "" || oldMeta.GetResourceVersion() != newMeta.GetResourceVersion() {
+		c.touch(newObj)
+	}
+}
+
+// stale returns true if the informer has not observed any change within maxStaleness.
+func (c *cachedInformer) stale(maxStaleness time.Duration) bool {
+	lastEvent := time.Unix(0, atomic.LoadInt64(&c.lastEvent))
+	return time.Since(lastEvent) > maxStaleness
+}
+
+// newResourceCache creates a resourceCache. Without a dynamic factory only the built-in resource types are cached.
+func newResourceCache(factory informers.SharedInformerFactory, dynamicFactory dynamicinformer.DynamicSharedInformerFactory,
+	maxStaleness time.Duration, stopCh <-chan struct{}) *resourceCache {
+	return &resourceCache{
+		factory:        factory,
+		dynamicFactory: dynamicFactory,
+		maxStaleness:   maxStaleness,
+		stopCh:         stopCh,
+		informers:      map[schema.GroupVersionResource]*cachedInformer{},
+	}
+}
+
+// informerFor returns the informer for gvr, creating and starting it on first use.
+func (c *resourceCache) informerFor(gvr schema.GroupVersionResource) (*cachedInformer, error) {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+
+	if informer, ok := c.informers[gvr]; ok {
+		return informer, nil
+	}
+
+	genericInformer, err := c.factory.ForResource(gvr)
+	if err != nil {
+		if c.dynamicFactory == nil {
+			return nil, err
+		}
+		genericInformer = c.dynamicFactory.ForResource(gvr)
+	}
+
+	// the initial list counts as an event, so a synced cache of an unused resource type starts out fresh
+	informer := &cachedInformer{GenericInformer: genericInformer}
+	informer.touch(nil)
+	genericInformer.Informer().AddEventHandler(cache.ResourceEventHandlerFuncs{
+		AddFunc:    informer.touch,
+		UpdateFunc: informer.touchChanged,
+		DeleteFunc: informer.touch,
+	})
+	c.informers[gvr] = informer
+
+	// Start only runs the informers that have not been started yet
+	c.factory.Start(c.stopCh)
+	if c.dynamicFactory != nil {
+		c.dynamicFactory.Start(c.stopCh)
+	}
+	log.Infof("Started the informer cache for %s", gvr.String())
+	return informer, nil
+}
+
+// warm starts the informers for gvrs and blocks until they have synced, --cacheSyncTimeout has passed
+// or stopCh is closed. The cache is ready afterwards either way: resource types without an informer, or
+// whose informer has not synced, e.g. because listing them is forbidden, are counted from a live List.
+func (c *resourceCache) warm(gvrs []schema.GroupVersionResource) error {
+	defer atomic.StoreInt32(&c.synced, 1)
+
+	started := map[schema.GroupVersionResource]*cachedInformer{}
+	var hasSynced []cache.InformerSynced
+	for _, gvr := range gvrs {
+		informer, err := c.informerFor(gvr)
+		if err != nil {
+			log.Warnf("Unable to create the informer cache for %s: %s", gvr.String(), err.Error())
+			continue
+		}
+		started[gvr] = informer
+		hasSynced = append(hasSynced, informer.Informer().HasSynced)
+	}
+
+	waitCh, done := make(chan struct{}), make(chan struct{})
+	defer close(done)
+	go func() {
+		defer close(waitCh)
+		select {
+		case <-c.stopCh:
+		case <-done:
+		case <-time.After(*cacheSyncWait):
+		}
+	}()
+	if !cache.WaitForCacheSync(waitCh, hasSynced...) {
+		var unsynced []string
+		for _, gvr := range gvrs {
+			if informer, ok := started[gvr]; ok && !informer.Informer().HasSynced() {
+				unsynced = append(unsynced, gvr.String())
+			}
+		}
+		return fmt.Errorf("the informer caches for %v have not synced within %s, they are listed live until they do", unsynced, *cacheSyncWait)
+	}
+	log.Infof("Informer caches for %d resource types are synced", len(gvrs))
+	return nil
+}
+
+// ready returns true once the initial set of informers has synced or stopped being waited for.
+func (c *resourceCache) ready() bool {
+	return atomic.LoadInt32(&c.synced) == 1
+}
+
+// objects returns the gvr resources in namespace, or every one of them if namespace is v1.NamespaceAll.
+// ok is false if the cache for gvr has not synced yet or has not observed a change within maxStaleness,
+// in which case the caller has to fall back to a live List.
+func (c *resourceCache) objects(gvr schema.GroupVersionResource, namespace string) (objects []v1.Object, ok bool) {
+	informer, err := c.informerFor(gvr)
+	if err != nil {
+		log.Debugf("No informer cache for %s: %s", gvr.String(), err.Error())
+		return nil, false
+	}
+	if !informer.Informer().HasSynced() {
+		log.Debugf("Informer cache for %s has not synced yet, falling back to a live List", gvr.String())
+		return nil, false
+	}
+	if informer.stale(c.maxStaleness) {
+		log.Debugf("Informer cache for %s has not seen any change for %s, falling back to a live List", gvr.String(), c.maxStaleness)
+		return nil, false
+	}
+
+	var list []runtime.Object
+	if namespace == v1.NamespaceAll {
+		list, err = informer.Lister().List(labels.Everything())
+	} else {
+		list, err = informer.Lister().ByNamespace(namespace).List(labels.Everything())
+	}
+	if err != nil {
+		log.Debugf("Error listing %s from the informer cache: %s", gvr.String(), err.Error())
+		return nil, false
+	}
+	objects = make([]v1.Object, 0, len(list))
+	for _, obj := range list {
+		object, err := meta.Accessor(obj)
+		if err != nil {
+			log.Debugf("Error reading the metadata of %s from the informer cache: %s", gvr.String(), err.Error())
+			return nil, false
+		}
+		objects = append(objects, object)
+	}
+	return objects, true
+}
@@ -0,0 +1,146 @@
+// Copyright 2017 Yahoo Holdings Inc. 
+// Licensed under the terms of the 3-Clause BSD License.
+package main
+
+import (
+	"errors"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+	"time"
+
+	corev1 "k8s.io/api/core/v1"
+	apiErrors "k8s.io/apimachinery/pkg/api/errors"
+	"k8s.io/apimachinery/pkg/apis/meta/v1"
+	"k8s.io/apimachinery/pkg/runtime"
+	"k8s.io/apimachinery/pkg/runtime/schema"
+	"k8s.io/client-go/informers"
+	"k8s.io/client-go/kubernetes/fake"
+	clienttesting "k8s.io/client-go/testing"
+
+	"github.com/stretchr/testify/assert"
+)
+
+var podsResourceType = schema.GroupVersionResource{Group: "", Version: "v1", Resource: "pods"}
+
+func newTestResourceCache(maxStaleness time.Duration, stopCh chan struct{}) *resourceCache {
+	testPod := &corev1.Pod{
+		ObjectMeta: v1.ObjectMeta{
+			Name:      "test-pod",
+			Namespace: "test-namespace",
+		},
+	}
+	clientset = fake.NewSimpleClientset(testPod, cloneNamespace(templateNamespace))
+	return newResourceCache(informers.NewSharedInformerFactory(clientset, 0), nil, maxStaleness, stopCh)
+}
+
+func TestResourceCacheCount(t *testing.T) {
+	stopCh := make(chan struct{})
+	defer close(stopCh)
+	testCache := newTestResourceCache(time.Minute, stopCh)
+
+	assert.False(t, testCache.ready(), "cache should not be ready before it is warmed")
+	assert.Nil(t, testCache.warm([]schema.GroupVersionResource{podsResourceType}), "Error should be nil")
+	assert.True(t, testCache.ready(), "cache should be ready once the informers have synced")
+
+	objects, ok := testCache.objects(podsResourceType, "test-namespace")
+	assert.True(t, ok, "should answer from the synced cache")
+	if assert.Len(t, objects, 1) {
+		assert.Equal(t, "test-pod", objects[0].GetName())
+	}
+
+	objects, ok = testCache.objects(podsResourceType, "other-namespace")
+	assert.True(t, ok, "should answer from the synced cache")
+	assert.Len(t, objects, 0)
+}
+
+func TestResourceCacheStale(t *testing.T) {
+	stopCh := make(chan struct{})
+	defer close(stopCh)
+	testCache := newTestResourceCache(0, stopCh)
+
+	assert.Nil(t, testCache.warm([]schema.GroupVersionResource{podsResourceType}), "Error should be nil")
+
+	_, ok := testCache.objects(podsResourceType, "test-namespace")
+	assert.False(t, ok, "should fall back to a live List if the cache is stale")
+}
+
+func TestResourceCacheResync(t *testing.T) {
+	stopCh := make(chan struct{})
+	defer close(stopCh)
+	testPod := &corev1.Pod{ObjectMeta: v1.ObjectMeta{Name: "test-pod", Namespace: "test-namespace", ResourceVersion: "1"}}
+	clientset = fake.NewSimpleClientset(testPod)
+	// informers resync once a second at most
+	testCache := newResourceCache(informers.NewSharedInformerFactory(clientset, time.Second), nil, 1500*time.Millisecond, stopCh)
+
+	assert.Nil(t, testCache.warm([]schema.GroupVersionResource{podsResourceType}), "Error should be nil")
+	time.Sleep(2500 * time.Millisecond)
+
+	_, ok := testCache.objects(podsResourceType, "test-namespace")
+	assert.False(t, ok, "should fall back to a live List if the cache only observed resyncs")
+}
+
+func TestResourceCacheSyncTimeout(t *testing.T) {
+	defer func(wait time.Duration) { *cacheSyncWait = wait }(*cacheSyncWait)
+	*cacheSyncWait = 100 * time.Millisecond
+	stopCh := make(chan struct{})
+	defer close(stopCh)
+	fakeClientset := fake.NewSimpleClientset()
+	fakeClientset.PrependReactor("list", "pods", func(action clienttesting.Action) (bool, runtime.Object, error) {
+		return true, nil, apiErrors.NewForbidden(schema.GroupResource{Resource: "pods"}, "", errors.New("not allowed"))
+	})
+	clientset = fakeClientset
+	testCache := newResourceCache(informers.NewSharedInformerFactory(clientset, 0), nil, time.Minute, stopCh)
+
+	err := testCache.warm([]schema.GroupVersionResource{podsResourceType})
+	if assert.NotNil(t, err, "should report the informer caches that have not synced") {
+		assert.Contains(t, err.Error(), "/v1, Resource=pods")
+	}
+	assert.True(t, testCache.ready(), "cache should be ready once the sync timeout has passed")
+
+	_, ok := testCache.objects(podsResourceType, "test-namespace")
+	assert.False(t, ok, "should fall back to a live List if the cache has not synced")
+}
+
+func TestResourceCacheUnknownResource(t *testing.T) {
+	stopCh := make(chan struct{})
+	defer close(stopCh)
+	testCache := newTestResourceCache(time.Minute, stopCh)
+
+	_, ok := testCache.objects(schema.GroupVersionResource{Group: "argoproj.io", Version: "v1alpha1", Resource: "rollouts"}, "test-namespace")
+	assert.False(t, ok, "should fall back to a live List if there is no informer for the resource")
+}
+
+func TestCachedValidateNamespaceDeletion(t *testing.T) {
+	stopCh := make(chan struct{})
+	defer close(stopCh)
+	objectCache = newTestResourceCache(time.Minute, stopCh)
+	defer func() { objectCache = nil }()
+
+	var gvrs []schema.GroupVersionResource
+	for _, c := range staticCounters {
+		gvrs = append(gvrs, c.gvr)
+	}
+	assert.Nil(t, objectCache.warm(gvrs), "Error should be nil")
+
+	_, _, _, err := validateNamespaceDeletion("test-namespace", nil, 0)
+	assert.NotNil(t, err, "should reject if the cached namespace has pod resources")
+	assert.Contains(t, err.Error(), "The namespace test-namespace you are trying to remove contains one or more of these resources: [pods(1)].")
+}
+
+func TestReadinessHandler(t *testing.T) {
+	stopCh := make(chan struct{})
+	defer close(stopCh)
+	objectCache = newTestResourceCache(time.Minute, stopCh)
+	defer func() { objectCache = nil }()
+
+	rw := httptest.NewRecorder()
+	readinessHandler(rw, httptest.NewRequest("GET", "http://localhost:8080/ready.html", nil))
+	assert.Equal(t, http.StatusServiceUnavailable, rw.Code, "/ready.html should return 503 until the caches have synced")
+
+	assert.Nil(t, objectCache.warm([]schema.GroupVersionResource{podsResourceType}), "Error should be nil")
+
+	rw = httptest.NewRecorder()
+	readinessHandler(rw, httptest.NewRequest("GET", "http://localhost:8080/ready.html", nil))
+	assert.Equal(t, http.StatusOK, rw.Code, "/ready.html should return 200 once the caches have synced")
+}
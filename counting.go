@@ -0,0 +1,119 @@
+// Copyright 2017 Yahoo Holdings Inc. 
+// Licensed under the terms of the 3-Clause BSD License.
+package main
+
+import (
+	"fmt"
+
+	corev1 "k8s.io/api/core/v1"
+	"k8s.io/apimachinery/pkg/apis/meta/v1"
+	"k8s.io/apimachinery/pkg/apis/meta/v1/unstructured"
+	"k8s.io/apimachinery/pkg/runtime/schema"
+)
+
+var (
+	podsGroupResource = schema.GroupResource{Group: "", Resource: "pods"}
+
+	// defaultCountedPodPhases leave out the pods of completed jobs, which no longer run anything
+	defaultCountedPodPhases = []string{string(corev1.PodPending), string(corev1.PodRunning), string(corev1.PodUnknown)}
+
+	podPhases = []string{string(corev1.PodPending), string(corev1.PodRunning), string(corev1.PodSucceeded),
+		string(corev1.PodFailed), string(corev1.PodUnknown)}
+)
+
+// reasons an object is not counted, as reported in the debug logs
+const (
+	skipIgnored     = "ignored"
+	skipTerminating = "terminating"
+	skipPhase       = "phase"
+)
+
+// countingPolicy decides which objects are counted according to their lifecycle.
+type countingPolicy struct {
+	// CountTerminating counts the objects carrying a deletionTimestamp, which are ignored by default
+	// as they are already going away.
+	CountTerminating bool `json:"countTerminating,omitempty"`
+	// CountedPodPhases are the phases of the pods that are counted, Pending, Running and Unknown by
+	// default so that Succeeded and Failed pods do not block a deletion.
+	CountedPodPhases []string `json:"countedPodPhases,omitempty"`
+}
+
+// validate checks the pod phases.
+func (p *countingPolicy) validate() error {
+	for i, phase := range p.CountedPodPhases {
+		if !containsString(podPhases, phase) {
+			return fmt.Errorf("countedPodPhases[%d]: unknown pod phase %q, expected one of %v", i, phase, podPhases)
+		}
+	}
+	return nil
+}
+
+// countedPodPhases returns the phases of the pods that are counted
+func (p *countingPolicy) countedPodPhases() []string {
+	if len(p.CountedPodPhases) == 0 {
+		return defaultCountedPodPhases
+	}
+	return p.CountedPodPhases
+}
+
+// filtersPhases returns true if pods of groupResource are counted according to their phase, which
+// requires listing whole objects instead of their metadata.
+func (p *countingPolicy) filtersPhases(groupResource schema.GroupResource) bool {
+	if groupResource != podsGroupResource {
+		return false
+	}
+	for _, phase := range podPhases {
+		if !containsString(p.countedPodPhases(), phase) {
+			return true
+		}
+	}
+	return false
+}
+
+// skipReason returns why object of groupResource is not counted, or an empty string if it is.
+func (p *countingPolicy) skipReason(groupResource schema.GroupResource, object v1.Object) string {
+	if !p.CountTerminating && object.GetDeletionTimestamp() != nil {
+		return skipTerminating
+	}
+	if p.filtersPhases(groupResource) {
+		if phase, ok := podPhase(object); ok && !containsString(p.countedPodPhases(), phase) {
+			return fmt.Sprintf("%s %s", skipPhase, phase)
+		}
+	}
+	return ""
+}
+
+// podPhase returns the phase of a typed or unstructured pod, false if object does not hold its status
+// or the phase is not set yet.
+func podPhase(object v1.Object) (string, bool) {
+	switch pod := object.(type) {
+	case *corev1.Pod:
+		return string(pod.Status.Phase), pod.Status.Phase != ""
+	case *unstructured.Unstructured:
+		phase, _, err := unstructured.NestedString(pod.Object, "status", "phase")
+		return phase, phase != "" && err == nil
+	}
+	return "", false
+}
+
+// filterObjects splits the objects of groupResource into those counted and those skipped, by reason.
+func (p *policy) filterObjects(groupResource schema.GroupResource, objects []v1.Object) (counted []v1.Object, skipped map[string][]v1.Object) {
+	skipped = map[string][]v1.Object{}
+	objects, ignored := filterIgnored(p.ignoreRulesFor(groupResource), objects)
+	if len(ignored) > 0 {
+		skipped[skipIgnored] = ignored
+	}
+	for _, object := range objects {
+		if reason := p.Counting.skipReason(groupResource, object); reason != "" {
+			skipped[reason] = append(skipped[reason], object)
+			continue
+		}
+		counted = append(counted, object)
+	}
+	return counted, skipped
+}
+
+// filtersObjects returns true if some objects of groupResource may not be counted.
+func (p *policy) filtersObjects(groupResource schema.GroupResource) bool {
+	return !p.Counting.CountTerminating || p.Counting.filtersPhases(groupResource) || len(p.ignoreRulesFor(groupResource)) > 0
+}
@@ -0,0 +1,94 @@
+// Copyright 2017 Yahoo Holdings Inc. 
+// Licensed under the terms of the 3-Clause BSD License.
+package main
+
+import (
+	"net/http/httptest"
+	"os"
+	"testing"
+
+	corev1 "k8s.io/api/core/v1"
+	"k8s.io/apimachinery/pkg/apis/meta/v1"
+	"k8s.io/apimachinery/pkg/apis/meta/v1/unstructured"
+	"k8s.io/client-go/kubernetes/fake"
+
+	"github.com/stretchr/testify/assert"
+)
+
+func newPodInPhase(name string, phase corev1.PodPhase) *corev1.Pod {
+	return &corev1.Pod{
+		ObjectMeta: v1.ObjectMeta{Name: name, Namespace: "test-namespace"},
+		Status:     corev1.PodStatus{Phase: phase},
+	}
+}
+
+func TestCountingPolicyFilter(t *testing.T) {
+	p := &policy{}
+	assert.Nil(t, p.validate(false), "Error should be nil")
+
+	terminating := newPodInPhase("web-2", corev1.PodRunning)
+	now := v1.Now()
+	terminating.DeletionTimestamp = &now
+	unstructuredPod := newUnstructured("v1", "Pod", "test-namespace", "report-3")
+	unstructured.SetNestedField(unstructuredPod.Object, "Failed", "status", "phase")
+
+	counted, skipped := p.filterObjects(podsGroupResource, []v1.Object{
+		newPodInPhase("web-1", corev1.PodRunning),
+		terminating,
+		newPodInPhase("migrate-1", corev1.PodSucceeded),
+		unstructuredPod,
+		newPodInPhase("scheduling-1", ""),
+	})
+	if assert.Len(t, counted, 2) {
+		assert.Equal(t, "web-1", counted[0].GetName())
+		assert.Equal(t, "scheduling-1", counted[1].GetName(), "should count pods without a phase")
+	}
+	assert.Len(t, skipped[skipTerminating], 1)
+	assert.Len(t, skipped["phase Succeeded"], 1)
+	assert.Len(t, skipped["phase Failed"], 1, "should read the phase of unstructured pods")
+
+	p = &policy{Counting: countingPolicy{CountTerminating: true, CountedPodPhases: podPhases}}
+	assert.Nil(t, p.validate(false), "Error should be nil")
+	counted, skipped = p.filterObjects(podsGroupResource, []v1.Object{terminating, newPodInPhase("migrate-1", corev1.PodSucceeded)})
+	assert.Len(t, counted, 2, "should count every pod")
+	assert.Empty(t, skipped)
+	assert.False(t, p.filtersObjects(podsGroupResource), "should not need to filter pods")
+}
+
+func TestInvalidCountingPolicy(t *testing.T) {
+	filename := writePolicyFile("counting:\n  countedPodPhases: [Running, Completed]\n")
+	defer os.Remove(filename)
+
+	_, err := loadPolicy(filename, false)
+	if assert.NotNil(t, err, "should reject unknown pod phases") {
+		assert.Contains(t, err.Error(), `counting: countedPodPhases[1]: unknown pod phase "Completed"`)
+	}
+}
+
+func TestCompletedPodsWebhookHandler(t *testing.T) {
+	clientset = fake.NewSimpleClientset(
+		newPodInPhase("migrate-1", corev1.PodSucceeded),
+		newPodInPhase("report-1", corev1.PodFailed),
+		cloneNamespace(templateNamespace),
+	)
+
+	rw := httptest.NewRecorder()
+	req := httptest.NewRequest("POST", "http://localhost:8080/", constructPostBody(cloneAdmissionReview(templateAdmReview)))
+	webhookHandler(rw, req)
+	assert.True(t, getAdmissionReview(rw).Status.Allowed, "should approve if the namespace only holds completed pods")
+
+	filename := writePolicyFile("counting:\n  countedPodPhases: [Pending, Running, Failed, Unknown]\n")
+	defer os.Remove(filename)
+	testPolicy, err := loadPolicy(filename, false)
+	assert.Nil(t, err, "Error should be nil")
+	defer activePolicy.Store(currentPolicy())
+	activePolicy.Store(testPolicy)
+
+	rw = httptest.NewRecorder()
+	req = httptest.NewRequest("POST", "http://localhost:8080/", constructPostBody(cloneAdmissionReview(templateAdmReview)))
+	webhookHandler(rw, req)
+
+	admReview := getAdmissionReview(rw)
+	assert.False(t, admReview.Status.Allowed, "should reject if failed pods are counted")
+	assert.Contains(t, admReview.Status.Result.Reason, "[pods(1)]")
+}
@@ -0,0 +1,330 @@
+// Copyright 2017 Yahoo Holdings Inc. 
+// Licensed under the terms of the 3-Clause BSD License.
+package main
+
+import (
+	"fmt"
+	"regexp"
+	"strings"
+	"sync"
+
+	corev1 "k8s.io/api/core/v1"
+	networkingv1 "k8s.io/api/networking/v1"
+	networkingv1beta1 "k8s.io/api/networking/v1beta1"
+	rbacv1 "k8s.io/api/rbac/v1"
+	"k8s.io/apimachinery/pkg/apis/meta/v1"
+	"k8s.io/apimachinery/pkg/labels"
+)
+
+// causeTypeDependency is the type of the status causes listing the references from other namespaces
+const causeTypeDependency v1.CauseType = "CrossNamespaceDependency"
+
+// dependencyAction is how the references to a namespace from other namespaces are reported
+type dependencyAction string
+
+const (
+	dependencyIgnore dependencyAction = "ignore"
+	dependencyWarn   dependencyAction = "warn"
+	dependencyBlock  dependencyAction = "block"
+)
+
+// dependencyPolicy decides which references to a namespace from other namespaces are looked for, and
+// whether they block its deletion or are reported as admission warnings. They are ignored by default,
+// as finding them lists the resources of every namespace.
+type dependencyPolicy struct {
+	// ExternalNameServices are ExternalName services resolving to a service of the namespace.
+	ExternalNameServices dependencyAction `json:"externalNameServices,omitempty"`
+	// NetworkPolicies are network policies whose namespaceSelector matches the namespace.
+	NetworkPolicies dependencyAction `json:"networkPolicies,omitempty"`
+	// RoleBindings are role bindings and cluster role bindings granting access to the service accounts of the namespace.
+	RoleBindings dependencyAction `json:"roleBindings,omitempty"`
+	// Ingresses are ingresses routing to the namespace through ExternalName services.
+	Ingresses dependencyAction `json:"ingresses,omitempty"`
+}
+
+// validate checks the actions.
+func (p *dependencyPolicy) validate() error {
+	for _, action := range []struct {
+		name   string
+		action dependencyAction
+	}{
+		{"externalNameServices", p.ExternalNameServices},
+		{"networkPolicies", p.NetworkPolicies},
+		{"roleBindings", p.RoleBindings},
+		{"ingresses", p.Ingresses},
+	} {
+		switch action.action {
+		case "", dependencyIgnore, dependencyWarn, dependencyBlock:
+		default:
+			return fmt.Errorf("%s: unknown action %q, expected %s, %s or %s", action.name, action.action, dependencyIgnore, dependencyWarn, dependencyBlock)
+		}
+	}
+	return nil
+}
+
+// counters returns the dependency checks that are not ignored. They are meant for a single request: the
+// ExternalName and ingress checks share the list of the ExternalName services.
+func (p *dependencyPolicy) counters() []resourceCounter {
+	lookup := &externalNameLookup{}
+	var counters []resourceCounter
+	for _, check := range []struct {
+		action  dependencyAction
+		counter resourceCounter
+		list    func(namespace string) ([]v1.Object, error)
+	}{
+		{p.ExternalNameServices, externalNameCheck, lookup.externalNameReferenceCounter},
+		{p.NetworkPolicies, networkPolicyCheck, networkPolicyReferenceCounter},
+		{p.RoleBindings, roleBindingCheck, roleBindingReferenceCounter},
+		{p.Ingresses, ingressCheck, lookup.ingressReferenceCounter},
+	} {
+		if check.action != dependencyWarn && check.action != dependencyBlock {
+			continue
+		}
+		check.counter.counter = check.list
+		risk := *check.counter.risk
+		risk.warn = check.action == dependencyWarn
+		check.counter.risk = &risk
+		counters = append(counters, check.counter)
+	}
+	return counters
+}
+
+// describeReference returns the namespace and name of a referencing object, along with what it refers to
+func describeReference(object v1.Object, reference string) string {
+	name := object.GetName()
+	if object.GetNamespace() != "" {
+		name = object.GetNamespace() + "/" + name
+	}
+	return fmt.Sprintf("%s (%s)", name, reference)
+}
+
+// externalNamePattern matches the cluster DNS names of the services of namespace, e.g. db.namespace.svc.cluster.local
+func externalNamePattern(namespace string) *regexp.Regexp {
+	return regexp.MustCompile(`^[^.]+\.` + regexp.QuoteMeta(namespace) + `\.svc(\.|$)`)
+}
+
+// externalNameCheck finds the ExternalName services pointing at the services of a namespace
+var externalNameCheck = resourceCounter{
+	kind: "externalname-references",
+	risk: &riskCheck{
+		description: "is referenced by ExternalName services in other namespaces, which would no longer resolve",
+		causeType:   causeTypeDependency,
+		describe: func(object v1.Object) string {
+			return describeReference(object, object.(*corev1.Service).Spec.ExternalName)
+		},
+	},
+}
+
+// externalNameLookup lists the services of every namespace at most once, so the ExternalName and
+// ingress checks of a request share the ExternalName services it finds.
+type externalNameLookup struct {
+	once     sync.Once
+	services []*corev1.Service
+	err      error
+}
+
+// externalNameServices returns the ExternalName services in other namespaces resolving to a service of namespace
+func (l *externalNameLookup) externalNameServices(namespace string) ([]*corev1.Service, error) {
+	l.once.Do(func() {
+		l.services, l.err = listExternalNameServices(namespace)
+	})
+	return l.services, l.err
+}
+
+// listExternalNameServices lists the ExternalName services in other namespaces resolving to a service of namespace
+func listExternalNameServices(namespace string) ([]*corev1.Service, error) {
+	list, err := clientset.CoreV1().Services(v1.NamespaceAll).List(v1.ListOptions{})
+	if err != nil {
+		return nil, err
+	}
+	pattern := externalNamePattern(namespace)
+	var services []*corev1.Service
+	for i := range list.Items {
+		service := &list.Items[i]
+		if service.Namespace != namespace && service.Spec.Type == corev1.ServiceTypeExternalName &&
+			pattern.MatchString(strings.TrimSuffix(service.Spec.ExternalName, ".")) {
+			services = append(services, service)
+		}
+	}
+	return services, nil
+}
+
+// externalNameReferenceCounter returns the ExternalName services referencing namespace as objects
+func (l *externalNameLookup) externalNameReferenceCounter(namespace string) ([]v1.Object, error) {
+	services, err := l.externalNameServices(namespace)
+	if err != nil {
+		return nil, err
+	}
+	objects := make([]v1.Object, len(services))
+	for i, service := range services {
+		objects[i] = service
+	}
+	return objects, nil
+}
+
+// networkPolicyCheck finds the network policies allowing traffic from or to a namespace by its labels
+var networkPolicyCheck = resourceCounter{
+	kind: "networkpolicy-references",
+	risk: &riskCheck{
+		description: "is selected by the namespaceSelector of network policies in other namespaces",
+		causeType:   causeTypeDependency,
+		describe: func(object v1.Object) string {
+			return describeReference(object, "namespaceSelector")
+		},
+	},
+}
+
+// networkPolicyReferenceCounter returns the network policies in other namespaces with a peer whose namespaceSelector
+// matches namespace. Empty selectors match every namespace and are not references to this one.
+func networkPolicyReferenceCounter(namespace string) ([]v1.Object, error) {
+	ns, err := clientset.CoreV1().Namespaces().Get(namespace, v1.GetOptions{})
+	if err != nil {
+		return nil, err
+	}
+	list, err := clientset.NetworkingV1().NetworkPolicies(v1.NamespaceAll).List(v1.ListOptions{})
+	if err != nil {
+		return nil, err
+	}
+	var objects []v1.Object
+	for i := range list.Items {
+		policy := &list.Items[i]
+		if policy.Namespace == namespace {
+			continue
+		}
+		var peers []networkingv1.NetworkPolicyPeer
+		for _, rule := range policy.Spec.Ingress {
+			peers = append(peers, rule.From...)
+		}
+		for _, rule := range policy.Spec.Egress {
+			peers = append(peers, rule.To...)
+		}
+		for _, peer := range peers {
+			if peer.NamespaceSelector == nil || (len(peer.NamespaceSelector.MatchLabels) == 0 && len(peer.NamespaceSelector.MatchExpressions) == 0) {
+				continue
+			}
+			selector, err := v1.LabelSelectorAsSelector(peer.NamespaceSelector)
+			if err == nil && selector.Matches(labels.Set(ns.Labels)) {
+				objects = append(objects, policy)
+				break
+			}
+		}
+	}
+	return objects, nil
+}
+
+// roleBindingCheck finds the bindings granting roles to the service accounts of a namespace
+var roleBindingCheck = resourceCounter{
+	kind: "rolebinding-references",
+	risk: &riskCheck{
+		description: "has service accounts granted access by role bindings outside of it",
+		causeType:   causeTypeDependency,
+		describe:    describeBinding,
+	},
+}
+
+// bindsServiceAccounts tells whether subjects hold a service account of namespace, or the group of all of them
+func bindsServiceAccounts(subjects []rbacv1.Subject, namespace string) bool {
+	for _, subject := range subjects {
+		if (subject.Kind == rbacv1.ServiceAccountKind && subject.Namespace == namespace) ||
+			(subject.Kind == rbacv1.GroupKind && subject.Name == "system:serviceaccounts:"+namespace) {
+			return true
+		}
+	}
+	return false
+}
+
+// roleBindingReferenceCounter returns the role bindings in other namespaces and the cluster role bindings
+// granting access to the service accounts of namespace.
+func roleBindingReferenceCounter(namespace string) ([]v1.Object, error) {
+	roleBindings, err := clientset.RbacV1().RoleBindings(v1.NamespaceAll).List(v1.ListOptions{})
+	if err != nil {
+		return nil, err
+	}
+	clusterRoleBindings, err := clientset.RbacV1().ClusterRoleBindings().List(v1.ListOptions{})
+	if err != nil {
+		return nil, err
+	}
+	var objects []v1.Object
+	for i := range roleBindings.Items {
+		binding := &roleBindings.Items[i]
+		if binding.Namespace != namespace && bindsServiceAccounts(binding.Subjects, namespace) {
+			objects = append(objects, binding)
+		}
+	}
+	for i := range clusterRoleBindings.Items {
+		binding := &clusterRoleBindings.Items[i]
+		if bindsServiceAccounts(binding.Subjects, namespace) {
+			objects = append(objects, binding)
+		}
+	}
+	return objects, nil
+}
+
+// describeBinding returns the name of a binding along with the role it grants, e.g. "team-b/readers (ClusterRole view)"
+func describeBinding(object v1.Object) string {
+	switch binding := object.(type) {
+	case *rbacv1.RoleBinding:
+		return describeReference(object, binding.RoleRef.Kind+" "+binding.RoleRef.Name)
+	case *rbacv1.ClusterRoleBinding:
+		return describeReference(object, binding.RoleRef.Kind+" "+binding.RoleRef.Name)
+	}
+	return object.GetName()
+}
+
+// ingressCheck finds the ingresses routing to a namespace
+var ingressCheck = resourceCounter{
+	kind: "ingress-references",
+	risk: &riskCheck{
+		description: "is routed to by ingresses in other namespaces through ExternalName services",
+		causeType:   causeTypeDependency,
+		describe: func(object v1.Object) string {
+			return describeReference(object, "ExternalName backend")
+		},
+	},
+}
+
+// ingressReferenceCounter returns the ingresses in other namespaces with a backend that is an ExternalName service
+// resolving to a service of namespace.
+func (l *externalNameLookup) ingressReferenceCounter(namespace string) ([]v1.Object, error) {
+	services, err := l.externalNameServices(namespace)
+	if err != nil || len(services) == 0 {
+		return nil, err
+	}
+	referencing := map[string]bool{}
+	for _, service := range services {
+		referencing[service.Namespace+"/"+service.Name] = true
+	}
+
+	list, err := clientset.NetworkingV1beta1().Ingresses(v1.NamespaceAll).List(v1.ListOptions{})
+	if err != nil {
+		return nil, err
+	}
+	var objects []v1.Object
+	for i := range list.Items {
+		ingress := &list.Items[i]
+		for _, serviceName := range ingressBackends(ingress) {
+			if referencing[ingress.Namespace+"/"+serviceName] {
+				objects = append(objects, ingress)
+				break
+			}
+		}
+	}
+	return objects, nil
+}
+
+// ingressBackends returns the names of the services an ingress routes to
+func ingressBackends(ingress *networkingv1beta1.Ingress) []string {
+	var names []string
+	if ingress.Spec.Backend != nil {
+		names = append(names, ingress.Spec.Backend.ServiceName)
+	}
+	for _, rule := range ingress.Spec.Rules {
+		if rule.HTTP == nil {
+			continue
+		}
+		for _, path := range rule.HTTP.Paths {
+			names = append(names, path.Backend.ServiceName)
+		}
+	}
+	return names
+}
@@ -0,0 +1,223 @@
+// Copyright 2017 Yahoo Holdings Inc. 
+// Licensed under the terms of the 3-Clause BSD License.
+package main
+
+import (
+	"net/http/httptest"
+	"os"
+	"sort"
+	"testing"
+
+	corev1 "k8s.io/api/core/v1"
+	networkingv1 "k8s.io/api/networking/v1"
+	networkingv1beta1 "k8s.io/api/networking/v1beta1"
+	rbacv1 "k8s.io/api/rbac/v1"
+	"k8s.io/apimachinery/pkg/apis/meta/v1"
+	"k8s.io/apimachinery/pkg/runtime"
+	"k8s.io/client-go/kubernetes/fake"
+	clienttesting "k8s.io/client-go/testing"
+
+	"github.com/stretchr/testify/assert"
+)
+
+func newExternalNameService(namespace, name, externalName string) *corev1.Service {
+	return &corev1.Service{
+		ObjectMeta: v1.ObjectMeta{Name: name, Namespace: namespace},
+		Spec:       corev1.ServiceSpec{Type: corev1.ServiceTypeExternalName, ExternalName: externalName},
+	}
+}
+
+func newNetworkPolicy(namespace, name string, selector *v1.LabelSelector) *networkingv1.NetworkPolicy {
+	return &networkingv1.NetworkPolicy{
+		ObjectMeta: v1.ObjectMeta{Name: name, Namespace: namespace},
+		Spec: networkingv1.NetworkPolicySpec{
+			Ingress: []networkingv1.NetworkPolicyIngressRule{{From: []networkingv1.NetworkPolicyPeer{{NamespaceSelector: selector}}}},
+		},
+	}
+}
+
+// describeObjects returns the sorted descriptions of objects by the risk check of c
+func describeObjects(c resourceCounter, objects []v1.Object) []string {
+	var descriptions []string
+	for _, object := range objects {
+		descriptions = append(descriptions, c.risk.describe(object))
+	}
+	sort.Strings(descriptions)
+	return descriptions
+}
+
+func TestExternalNameReferenceCounter(t *testing.T) {
+	clientset = fake.NewSimpleClientset(
+		newExternalNameService("team-b", "db", "db.test-namespace.svc.cluster.local."),
+		newExternalNameService("team-c", "cache", "cache.test-namespace.svc"),
+		newExternalNameService("team-c", "other", "db.test-namespace-2.svc.cluster.local"),
+		newExternalNameService("team-c", "external", "db.example.com"),
+		newExternalNameService("test-namespace", "alias", "db.test-namespace.svc.cluster.local"),
+	)
+
+	objects, err := new(externalNameLookup).externalNameReferenceCounter("test-namespace")
+	assert.Nil(t, err, "Error should be nil")
+	assert.Equal(t, []string{"team-b/db (db.test-namespace.svc.cluster.local.)", "team-c/cache (cache.test-namespace.svc)"},
+		describeObjects(externalNameCheck, objects), "should only count the services of other namespaces resolving into the namespace")
+}
+
+func TestNetworkPolicyReferenceCounter(t *testing.T) {
+	testNamespace := cloneNamespace(templateNamespace)
+	testNamespace.Labels = map[string]string{"team": "a"}
+	clientset = fake.NewSimpleClientset(
+		testNamespace,
+		newNetworkPolicy("team-b", "allow-team-a", &v1.LabelSelector{MatchLabels: map[string]string{"team": "a"}}),
+		newNetworkPolicy("team-b", "allow-team-c", &v1.LabelSelector{MatchLabels: map[string]string{"team": "c"}}),
+		newNetworkPolicy("team-b", "allow-all", &v1.LabelSelector{}),
+		newNetworkPolicy("test-namespace", "allow-self", &v1.LabelSelector{MatchLabels: map[string]string{"team": "a"}}),
+		&networkingv1.NetworkPolicy{
+			ObjectMeta: v1.ObjectMeta{Name: "egress-team-a", Namespace: "team-c"},
+			Spec: networkingv1.NetworkPolicySpec{Egress: []networkingv1.NetworkPolicyEgressRule{{To: []networkingv1.NetworkPolicyPeer{{
+				NamespaceSelector: &v1.LabelSelector{MatchExpressions: []v1.LabelSelectorRequirement{
+					{Key: "team", Operator: v1.LabelSelectorOpIn, Values: []string{"a", "b"}},
+				}},
+			}}}}},
+		},
+	)
+
+	objects, err := networkPolicyReferenceCounter("test-namespace")
+	assert.Nil(t, err, "Error should be nil")
+	assert.Equal(t, []string{"team-b/allow-team-a (namespaceSelector)", "team-c/egress-team-a (namespaceSelector)"},
+		describeObjects(networkPolicyCheck, objects), "should only count the policies of other namespaces selecting the namespace")
+}
+
+func TestRoleBindingReferenceCounter(t *testing.T) {
+	clientset = fake.NewSimpleClientset(
+		&rbacv1.RoleBinding{
+			ObjectMeta: v1.ObjectMeta{Name: "readers", Namespace: "team-b"},
+			Subjects:   []rbacv1.Subject{{Kind: rbacv1.ServiceAccountKind, Name: "default", Namespace: "test-namespace"}},
+			RoleRef:    rbacv1.RoleRef{Kind: "ClusterRole", Name: "view"},
+		},
+		&rbacv1.RoleBinding{
+			ObjectMeta: v1.ObjectMeta{Name: "self", Namespace: "test-namespace"},
+			Subjects:   []rbacv1.Subject{{Kind: rbacv1.ServiceAccountKind, Name: "default", Namespace: "test-namespace"}},
+			RoleRef:    rbacv1.RoleRef{Kind: "Role", Name: "edit"},
+		},
+		&rbacv1.RoleBinding{
+			ObjectMeta: v1.ObjectMeta{Name: "users", Namespace: "team-b"},
+			Subjects:   []rbacv1.Subject{{Kind: rbacv1.UserKind, Name: "jdoe"}},
+			RoleRef:    rbacv1.RoleRef{Kind: "ClusterRole", Name: "view"},
+		},
+		&rbacv1.ClusterRoleBinding{
+			ObjectMeta: v1.ObjectMeta{Name: "deployers"},
+			Subjects:   []rbacv1.Subject{{Kind: rbacv1.GroupKind, Name: "system:serviceaccounts:test-namespace"}},
+			RoleRef:    rbacv1.RoleRef{Kind: "ClusterRole", Name: "cluster-admin"},
+		},
+	)
+
+	objects, err := roleBindingReferenceCounter("test-namespace")
+	assert.Nil(t, err, "Error should be nil")
+	assert.Equal(t, []string{"deployers (ClusterRole cluster-admin)", "team-b/readers (ClusterRole view)"},
+		describeObjects(roleBindingCheck, objects), "should only count the bindings outside the namespace of its service accounts")
+}
+
+func TestIngressReferenceCounter(t *testing.T) {
+	clientset = fake.NewSimpleClientset(
+		newExternalNameService("team-b", "db", "db.test-namespace.svc.cluster.local"),
+		&networkingv1beta1.Ingress{
+			ObjectMeta: v1.ObjectMeta{Name: "web", Namespace: "team-b"},
+			Spec: networkingv1beta1.IngressSpec{Rules: []networkingv1beta1.IngressRule{{
+				IngressRuleValue: networkingv1beta1.IngressRuleValue{HTTP: &networkingv1beta1.HTTPIngressRuleValue{
+					Paths: []networkingv1beta1.HTTPIngressPath{{Path: "/db", Backend: networkingv1beta1.IngressBackend{ServiceName: "db"}}},
+				}},
+			}}},
+		},
+		&networkingv1beta1.Ingress{
+			ObjectMeta: v1.ObjectMeta{Name: "other", Namespace: "team-c"},
+			Spec:       networkingv1beta1.IngressSpec{Backend: &networkingv1beta1.IngressBackend{ServiceName: "db"}},
+		},
+	)
+
+	objects, err := new(externalNameLookup).ingressReferenceCounter("test-namespace")
+	assert.Nil(t, err, "Error should be nil")
+	assert.Equal(t, []string{"team-b/web (ExternalName backend)"}, describeObjects(ingressCheck, objects),
+		"should only count the ingresses routing to the ExternalName services of their namespace")
+}
+
+func TestSharedExternalNameServices(t *testing.T) {
+	fakeClientset := fake.NewSimpleClientset(newExternalNameService("team-b", "db", "db.test-namespace.svc.cluster.local"))
+	lists := 0
+	fakeClientset.PrependReactor("list", "services", func(action clienttesting.Action) (bool, runtime.Object, error) {
+		lists++
+		return false, nil, nil
+	})
+	clientset = fakeClientset
+
+	policy := &dependencyPolicy{ExternalNameServices: dependencyBlock, Ingresses: dependencyBlock}
+	for _, c := range policy.counters() {
+		_, err := c.counter("test-namespace")
+		assert.Nil(t, err, "Error should be nil")
+	}
+	assert.Equal(t, 1, lists, "should list the services once for the ExternalName and ingress checks")
+
+	for _, c := range policy.counters() {
+		_, err := c.counter("test-namespace")
+		assert.Nil(t, err, "Error should be nil")
+	}
+	assert.Equal(t, 2, lists, "should list the services again for another request")
+}
+
+func TestInvalidDependencyPolicy(t *testing.T) {
+	filename := writePolicyFile("dependencies:\n  roleBindings: reject\n")
+	defer os.Remove(filename)
+
+	_, err := loadPolicy(filename, false)
+	if assert.NotNil(t, err, "should reject unknown actions") {
+		assert.Contains(t, err.Error(), `dependencies: roleBindings: unknown action "reject"`)
+	}
+}
+
+func TestDependenciesWebhookHandler(t *testing.T) {
+	newClientset := func() {
+		clientset = fake.NewSimpleClientset(
+			cloneNamespace(templateNamespace),
+			newExternalNameService("team-b", "db", "db.test-namespace.svc.cluster.local"),
+		)
+	}
+
+	newClientset()
+	rw := httptest.NewRecorder()
+	req := httptest.NewRequest("POST", "http://localhost:8080/", constructPostBody(cloneAdmissionReview(templateAdmReview)))
+	webhookHandler(rw, req)
+	assert.True(t, getAdmissionReview(rw).Status.Allowed, "should ignore the references from other namespaces by default")
+
+	filename := writePolicyFile("dependencies:\n  externalNameServices: block\n")
+	defer os.Remove(filename)
+	testPolicy, err := loadPolicy(filename, false)
+	assert.Nil(t, err, "Error should be nil")
+	defer activePolicy.Store(currentPolicy())
+	activePolicy.Store(testPolicy)
+
+	newClientset()
+	rw = httptest.NewRecorder()
+	req = httptest.NewRequest("POST", "http://localhost:8080/", constructPostBody(cloneAdmissionReview(templateAdmReview)))
+	webhookHandler(rw, req)
+
+	admReview := getAdmissionReview(rw)
+	assert.False(t, admReview.Status.Allowed, "should reject if an ExternalName service of another namespace resolves into the namespace")
+	assert.Contains(t, admReview.Status.Result.Reason, "The namespace test-namespace is referenced by ExternalName services in other namespaces, "+
+		"which would no longer resolve: team-b/db (db.test-namespace.svc.cluster.local).")
+	assert.Equal(t, []v1.StatusCause{{Type: causeTypeDependency, Field: "externalname-references", Message: "team-b/db (db.test-namespace.svc.cluster.local)"}},
+		admReview.Status.Result.Details.Causes)
+
+	filename = writePolicyFile("dependencies:\n  externalNameServices: warn\n")
+	defer os.Remove(filename)
+	testPolicy, err = loadPolicy(filename, false)
+	assert.Nil(t, err, "Error should be nil")
+	activePolicy.Store(testPolicy)
+
+	newClientset()
+	rw = httptest.NewRecorder()
+	req = httptest.NewRequest("POST", "http://localhost:8080/", constructV1PostBody(admissionV1, templateAdmReview))
+	webhookHandler(rw, req)
+
+	v1Review := getV1AdmissionReview(rw)
+	assert.True(t, v1Review.Response.Allowed, "should approve if the references only warn")
+	assert.Equal(t, []string{"The namespace test-namespace is referenced by ExternalName services in other namespaces, " +
+		"which would no longer resolve: team-b/db (db.test-namespace.svc.cluster.local)."}, v1Review.Response.Warnings)
+}
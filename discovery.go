@@ -0,0 +1,134 @@
+// Copyright 2017 Yahoo Holdings Inc. 
+// Licensed under the terms of the 3-Clause BSD License.
+package main
+
+import (
+	"fmt"
+	"sort"
+	"strings"
+
+	"k8s.io/apimachinery/pkg/apis/meta/v1"
+	"k8s.io/apimachinery/pkg/runtime/schema"
+	"k8s.io/client-go/discovery"
+	"k8s.io/client-go/dynamic"
+)
+
+const (
+	// defaultExcludedResources are namespaced resources that are either created automatically in every
+	// namespace or do not represent a workload, mirroring what the built-in counter list ignores.
+	defaultExcludedResources = "events,events.k8s.io/events,configmaps,secrets,serviceaccounts,endpoints," +
+		"discovery.k8s.io/endpointslices,coordination.k8s.io/leases,metrics.k8s.io/*,apps/controllerrevisions"
+)
+
+var (
+	dynamicClient dynamic.Interface
+
+	// discoverNamespacedResources returns the preferred version of every namespaced resource served by the apiserver
+	discoverNamespacedResources = func() ([]*v1.APIResourceList, error) {
+		return clientset.Discovery().ServerPreferredNamespacedResources()
+	}
+)
+
+// groupResourceFilter selects the group/resources that are counted in discovery mode.
+// An empty include list considers every resource that is not excluded.
+type groupResourceFilter struct {
+	include []schema.GroupResource
+	exclude []schema.GroupResource
+}
+
+// parseGroupResources parses a comma separated list of group/resource entries.
+// Resources in the core group are written without a group, e.g. "pods,apps/deployments,argoproj.io/*".
+func parseGroupResources(list string) ([]schema.GroupResource, error) {
+	var groupResources []schema.GroupResource
+	for _, entry := range strings.Split(list, ",") {
+		entry = strings.TrimSpace(entry)
+		if entry == "" {
+			continue
+		}
+		groupResource := schema.GroupResource{Resource: entry}
+		if i := strings.LastIndex(entry, "/"); i >= 0 {
+			groupResource = schema.GroupResource{Group: entry[:i], Resource: entry[i+1:]}
+		}
+		if groupResource.Resource == "" || strings.Contains(groupResource.Group, "/") {
+			return nil, fmt.Errorf("invalid group/resource %q", entry)
+		}
+		groupResources = append(groupResources, groupResource)
+	}
+	return groupResources, nil
+}
+
+func matchesGroupResource(list []schema.GroupResource, groupResource schema.GroupResource) bool {
+	for _, entry := range list {
+		if entry.Group == groupResource.Group && (entry.Resource == "*" || entry.Resource == groupResource.Resource) {
+			return true
+		}
+	}
+	return false
+}
+
+// allows returns true if groupResource should be counted.
+func (f *groupResourceFilter) allows(groupResource schema.GroupResource) bool {
+	if matchesGroupResource(f.exclude, groupResource) {
+		return false
+	}
+	return len(f.include) == 0 || matchesGroupResource(f.include, groupResource)
+}
+
+// names returns true if groupResource is included by name rather than by a group wildcard or an empty include list.
+func (f *groupResourceFilter) names(groupResource schema.GroupResource) bool {
+	for _, entry := range f.include {
+		if entry == groupResource {
+			return true
+		}
+	}
+	return false
+}
+
+func dynamicCounter(gvr schema.GroupVersionResource) func(namespace string) ([]v1.Object, error) {
+	return func(namespace string) ([]v1.Object, error) {
+		list, err := dynamicClient.Resource(gvr).Namespace(namespace).List(v1.ListOptions{})
+		if err != nil {
+			return nil, err
+		}
+		objects := make([]v1.Object, len(list.Items))
+		for i := range list.Items {
+			objects[i] = &list.Items[i]
+		}
+		return objects, nil
+	}
+}
+
+// discoverCounters returns a counter for every listable namespaced resource allowed by the filter.
+// Counters are sorted by kind so that rejection messages are stable across requests. The resource types
+// the filter does not include by name are skipped when the guard is forbidden to list them, such as
+// CRDs the view role does not cover.
+func discoverCounters(filter *groupResourceFilter) ([]resourceCounter, error) {
+	lists, err := discoverNamespacedResources()
+	if err != nil {
+		// Some aggregated APIs may be unavailable, carry on with the groups that were discovered
+		if !discovery.IsGroupDiscoveryFailedError(err) || len(lists) == 0 {
+			return nil, err
+		}
+		log.Warnf("Partial failure while discovering namespaced resources: %s", err.Error())
+	}
+
+	lists = discovery.FilteredBy(discovery.SupportsAllVerbs{Verbs: []string{"list"}}, lists)
+	gvrs, err := discovery.GroupVersionResources(lists)
+	if err != nil {
+		return nil, err
+	}
+
+	var counters []resourceCounter
+	for gvr := range gvrs {
+		// skip subresources such as pods/log
+		if strings.Contains(gvr.Resource, "/") || !filter.allows(gvr.GroupResource()) {
+			continue
+		}
+		counters = append(counters, resourceCounter{kind: gvr.GroupResource().String(), gvr: gvr, counter: dynamicCounter(gvr),
+			skipForbidden: !filter.names(gvr.GroupResource())})
+	}
+	sort.Slice(counters, func(i, j int) bool {
+		return counters[i].kind < counters[j].kind
+	})
+	return counters, nil
+}
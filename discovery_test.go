@@ -0,0 +1,165 @@
+// Copyright 2017 Yahoo Holdings Inc. 
+// Licensed under the terms of the 3-Clause BSD License.
+package main
+
+import (
+	"errors"
+	"testing"
+
+	apiErrors "k8s.io/apimachinery/pkg/api/errors"
+	"k8s.io/apimachinery/pkg/apis/meta/v1"
+	"k8s.io/apimachinery/pkg/apis/meta/v1/unstructured"
+	"k8s.io/apimachinery/pkg/runtime"
+	"k8s.io/apimachinery/pkg/runtime/schema"
+	dynamicfake "k8s.io/client-go/dynamic/fake"
+	"k8s.io/client-go/kubernetes/fake"
+	clienttesting "k8s.io/client-go/testing"
+
+	"github.com/stretchr/testify/assert"
+)
+
+var testAPIResourceLists = []*v1.APIResourceList{
+	{
+		GroupVersion: "v1",
+		APIResources: []v1.APIResource{
+			{Name: "pods", Namespaced: true, Kind: "Pod", Verbs: v1.Verbs{"get", "list", "delete"}},
+			{Name: "pods/log", Namespaced: true, Kind: "Pod", Verbs: v1.Verbs{"get", "list"}},
+			{Name: "configmaps", Namespaced: true, Kind: "ConfigMap", Verbs: v1.Verbs{"get", "list", "delete"}},
+			{Name: "bindings", Namespaced: true, Kind: "Binding", Verbs: v1.Verbs{"create"}},
+		},
+	},
+	{
+		GroupVersion: "argoproj.io/v1alpha1",
+		APIResources: []v1.APIResource{
+			{Name: "rollouts", Namespaced: true, Kind: "Rollout", Verbs: v1.Verbs{"get", "list", "delete"}},
+		},
+	},
+}
+
+func newUnstructured(apiVersion, kind, namespace, name string) *unstructured.Unstructured {
+	return &unstructured.Unstructured{
+		Object: map[string]interface{}{
+			"apiVersion": apiVersion,
+			"kind":       kind,
+			"metadata": map[string]interface{}{
+				"namespace": namespace,
+				"name":      name,
+			},
+		},
+	}
+}
+
+func TestParseGroupResources(t *testing.T) {
+	groupResources, err := parseGroupResources("pods, apps/deployments,,argoproj.io/*")
+
+	assert.Nil(t, err, "Error should be nil")
+	assert.Equal(t, []schema.GroupResource{
+		{Group: "", Resource: "pods"},
+		{Group: "apps", Resource: "deployments"},
+		{Group: "argoproj.io", Resource: "*"},
+	}, groupResources)
+}
+
+func TestParseInvalidGroupResources(t *testing.T) {
+	for _, list := range []string{"apps/", "apps/v1/deployments"} {
+		_, err := parseGroupResources(list)
+		assert.NotNil(t, err, "should fail to parse %q", list)
+	}
+}
+
+func TestGroupResourceFilter(t *testing.T) {
+	testPolicy, err := newFlagPolicy("", "configmaps,metrics.k8s.io/*", true)
+	assert.Nil(t, err, "Error should be nil")
+
+	assert.True(t, testPolicy.filter.allows(schema.GroupResource{Resource: "pods"}))
+	assert.False(t, testPolicy.filter.allows(schema.GroupResource{Resource: "configmaps"}))
+	assert.False(t, testPolicy.filter.allows(schema.GroupResource{Group: "metrics.k8s.io", Resource: "pods"}))
+
+	testPolicy, err = newFlagPolicy("apps/*,pods", "apps/controllerrevisions", true)
+	assert.Nil(t, err, "Error should be nil")
+
+	assert.True(t, testPolicy.filter.allows(schema.GroupResource{Resource: "pods"}))
+	assert.True(t, testPolicy.filter.allows(schema.GroupResource{Group: "apps", Resource: "deployments"}))
+	assert.False(t, testPolicy.filter.allows(schema.GroupResource{Group: "apps", Resource: "controllerrevisions"}))
+	assert.False(t, testPolicy.filter.allows(schema.GroupResource{Resource: "services"}))
+}
+
+func TestDiscoveryModeValidateNamespaceDeletion(t *testing.T) {
+	discoverNamespacedResources = func() ([]*v1.APIResourceList, error) {
+		return testAPIResourceLists, nil
+	}
+	dynamicClient = dynamicfake.NewSimpleDynamicClient(runtime.NewScheme(),
+		newUnstructured("v1", "Pod", "test-namespace", "test-pod"),
+		newUnstructured("v1", "ConfigMap", "test-namespace", "test-configmap"),
+		newUnstructured("argoproj.io/v1alpha1", "Rollout", "test-namespace", "test-rollout"),
+	)
+	*discoveryMode = true
+	defer func() { *discoveryMode = false }()
+
+	testPolicy, err := newFlagPolicy("", "configmaps", true)
+	assert.Nil(t, err, "Error should be nil")
+	defer activePolicy.Store(currentPolicy())
+	activePolicy.Store(testPolicy)
+
+	counts, _, _, err := validateNamespaceDeletion("test-namespace", nil, 0)
+
+	assert.NotNil(t, err, "should reject if the namespace contains discovered resources")
+	assert.Contains(t, err.Error(), "The namespace test-namespace you are trying to remove contains one or more of these resources: [pods(1) rollouts.argoproj.io(1)].")
+	assert.Equal(t, 1, counts["rollouts.argoproj.io"])
+	assert.NotContains(t, counts, "configmaps", "excluded resources should not be counted")
+}
+
+func TestDiscoveryModeEmptyNamespace(t *testing.T) {
+	discoverNamespacedResources = func() ([]*v1.APIResourceList, error) {
+		return testAPIResourceLists, nil
+	}
+	dynamicClient = dynamicfake.NewSimpleDynamicClient(runtime.NewScheme(),
+		newUnstructured("v1", "Pod", "other-namespace", "test-pod"),
+	)
+	*discoveryMode = true
+	defer func() { *discoveryMode = false }()
+
+	testPolicy, err := newFlagPolicy("", defaultExcludedResources, true)
+	assert.Nil(t, err, "Error should be nil")
+	defer activePolicy.Store(currentPolicy())
+	activePolicy.Store(testPolicy)
+
+	_, _, _, err = validateNamespaceDeletion("test-namespace", nil, 0)
+	assert.Nil(t, err, "should approve if no discovered resources exist in the namespace")
+}
+
+func TestDiscoveryModeForbiddenResource(t *testing.T) {
+	discoverNamespacedResources = func() ([]*v1.APIResourceList, error) {
+		return testAPIResourceLists, nil
+	}
+	fakeDynamicClient := dynamicfake.NewSimpleDynamicClient(runtime.NewScheme(),
+		newUnstructured("v1", "Pod", "test-namespace", "test-pod"),
+	)
+	fakeDynamicClient.PrependReactor("list", "rollouts", func(action clienttesting.Action) (bool, runtime.Object, error) {
+		return true, nil, apiErrors.NewForbidden(schema.GroupResource{Group: "argoproj.io", Resource: "rollouts"}, "", errors.New("not allowed"))
+	})
+	dynamicClient = fakeDynamicClient
+	clientset = fake.NewSimpleClientset()
+	*discoveryMode = true
+	defer func() { *discoveryMode = false }()
+	defer activePolicy.Store(currentPolicy())
+
+	testPolicy, err := newFlagPolicy("", "configmaps", true)
+	assert.Nil(t, err, "Error should be nil")
+	activePolicy.Store(testPolicy)
+
+	_, _, _, err = validateNamespaceDeletion("test-namespace", nil, 0)
+	if assert.NotNil(t, err, "should reject if the namespace contains discovered resources") {
+		assert.Contains(t, err.Error(), "contains one or more of these resources: [pods(1)].")
+		assert.NotContains(t, err.Error(), "rollouts", "should skip the discovered resource types it may not list")
+	}
+
+	testPolicy, err = newFlagPolicy("argoproj.io/rollouts", "", true)
+	assert.Nil(t, err, "Error should be nil")
+	activePolicy.Store(testPolicy)
+
+	_, _, _, err = validateNamespaceDeletion("test-namespace", nil, 0)
+	if assert.NotNil(t, err, "should reject if a resource type named in the policy cannot be listed") {
+		assert.Contains(t, err.Error(), "error listing rollouts.argoproj.io")
+	}
+}
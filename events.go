@@ -0,0 +1,49 @@
+// Copyright 2017 Yahoo Holdings Inc. 
+// Licensed under the terms of the 3-Clause BSD License.
+package main
+
+import (
+	"fmt"
+
+	corev1 "k8s.io/api/core/v1"
+	"k8s.io/client-go/kubernetes"
+	"k8s.io/client-go/kubernetes/scheme"
+	typedcorev1 "k8s.io/client-go/kubernetes/typed/core/v1"
+	"k8s.io/client-go/tools/record"
+)
+
+// reasons of the events recorded on namespaces
+const (
+	eventDeletionRejected = "DeletionRejected"
+	eventDeletionBypassed = "DeletionBypassed"
+	eventDeletionAdmitted = "DeletionAdmittedWithoutValidation"
+)
+
+// eventRecorder records the events on namespaces, no events are recorded if it is nil
+var eventRecorder record.EventRecorder
+
+// newEventRecorder creates a recorder posting events through clientset.
+func newEventRecorder(clientset kubernetes.Interface) record.EventRecorder {
+	broadcaster := record.NewBroadcaster()
+	broadcaster.StartLogging(log.Debugf)
+	broadcaster.StartRecordingToSink(&typedcorev1.EventSinkImpl{Interface: clientset.CoreV1().Events("")})
+	return broadcaster.NewRecorder(scheme.Scheme, corev1.EventSource{Component: "k8s-namespace-guard"})
+}
+
+// recordNamespaceEvent records an event on the namespace of the review, so that it shows up in
+// `kubectl describe namespace`. namespace is nil if it has not been retrieved. Dry-run requests leave no trace.
+func recordNamespaceEvent(review *reviewRequest, namespace *corev1.Namespace, eventType, reason, messageFmt string, args ...interface{}) {
+	if eventRecorder == nil || (review.DryRun != nil && *review.DryRun) {
+		return
+	}
+	ref := &corev1.ObjectReference{
+		Kind:       "Namespace",
+		APIVersion: "v1",
+		Name:       review.Name,
+	}
+	if namespace != nil {
+		ref.UID = namespace.UID
+		ref.ResourceVersion = namespace.ResourceVersion
+	}
+	eventRecorder.Event(ref, eventType, reason, fmt.Sprintf(messageFmt, args...))
+}
@@ -0,0 +1,106 @@
+// Copyright 2017 Yahoo Holdings Inc. 
+// Licensed under the terms of the 3-Clause BSD License.
+package main
+
+import (
+	"net/http/httptest"
+	"testing"
+
+	corev1 "k8s.io/api/core/v1"
+	"k8s.io/apimachinery/pkg/apis/meta/v1"
+	"k8s.io/client-go/kubernetes/fake"
+	"k8s.io/client-go/tools/record"
+
+	"github.com/stretchr/testify/assert"
+)
+
+// recordedEvents returns the events recorded so far
+func recordedEvents(recorder *record.FakeRecorder) []string {
+	var events []string
+	for {
+		select {
+		case event := <-recorder.Events:
+			events = append(events, event)
+		default:
+			return events
+		}
+	}
+}
+
+func TestRejectedDeletionEvent(t *testing.T) {
+	recorder := record.NewFakeRecorder(10)
+	defer func() { eventRecorder = nil }()
+	eventRecorder = recorder
+
+	testPod := &corev1.Pod{
+		ObjectMeta: v1.ObjectMeta{
+			Name:      "test-pod",
+			Namespace: "test-namespace",
+		},
+	}
+	clientset = fake.NewSimpleClientset(testPod, cloneNamespace(templateNamespace))
+
+	testSpec := cloneAdmissionReview(templateAdmReview)
+	rw := httptest.NewRecorder()
+	req := httptest.NewRequest("POST", "http://localhost:8080/", constructPostBody(testSpec))
+	webhookHandler(rw, req)
+
+	events := recordedEvents(recorder)
+	if assert.Len(t, events, 1, "should record an event on the namespace") {
+		assert.Contains(t, events[0], "Warning DeletionRejected Deletion requested by user "+testSpec.Spec.UserInfo.Username+" rejected: ")
+		assert.Contains(t, events[0], "[pods(1)]")
+	}
+}
+
+func TestBypassedDeletionEvent(t *testing.T) {
+	recorder := record.NewFakeRecorder(10)
+	defer func() { eventRecorder = nil }()
+	eventRecorder = recorder
+
+	testNamespace := cloneNamespace(templateNamespace)
+	testNamespace.Annotations = map[string]string{bypassAnnotationKey: "true", bypassReasonAnnotationKey: "decommissioning test-namespace"}
+	clientset = fake.NewSimpleClientset(testNamespace)
+
+	rw := httptest.NewRecorder()
+	req := httptest.NewRequest("POST", "http://localhost:8080/", constructPostBody(cloneAdmissionReview(templateAdmReview)))
+	webhookHandler(rw, req)
+
+	events := recordedEvents(recorder)
+	if assert.Len(t, events, 1, "should record an event on the namespace") {
+		assert.Contains(t, events[0], "Normal DeletionBypassed ")
+		assert.Contains(t, events[0], "with reason: decommissioning test-namespace")
+	}
+}
+
+func TestAdmitAllDeletionEvent(t *testing.T) {
+	recorder := record.NewFakeRecorder(10)
+	defer func() { eventRecorder = nil }()
+	eventRecorder = recorder
+
+	*admitAll = true
+	defer func() { *admitAll = false }()
+	clientset = fake.NewSimpleClientset(cloneNamespace(templateNamespace))
+
+	rw := httptest.NewRecorder()
+	req := httptest.NewRequest("POST", "http://localhost:8080/", constructPostBody(cloneAdmissionReview(templateAdmReview)))
+	webhookHandler(rw, req)
+
+	events := recordedEvents(recorder)
+	if assert.Len(t, events, 1, "should record an event on the namespace") {
+		assert.Contains(t, events[0], "Warning DeletionAdmittedWithoutValidation ")
+	}
+}
+
+func TestEmptyNamespaceNoEvent(t *testing.T) {
+	recorder := record.NewFakeRecorder(10)
+	defer func() { eventRecorder = nil }()
+	eventRecorder = recorder
+
+	clientset = fake.NewSimpleClientset(cloneNamespace(templateNamespace))
+
+	rw := httptest.NewRecorder()
+	req := httptest.NewRequest("POST", "http://localhost:8080/", constructPostBody(cloneAdmissionReview(templateAdmReview)))
+	webhookHandler(rw, req)
+
+	assert.Empty(t, recordedEvents(recorder), "should not record an event for a regular deletion")
+}
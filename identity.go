@@ -0,0 +1,58 @@
+// Copyright 2017 Yahoo Holdings Inc. 
+// Licensed under the terms of the 3-Clause BSD License.
+package main
+
+import (
+	"fmt"
+	"strings"
+
+	authenticationv1 "k8s.io/api/authentication/v1"
+)
+
+// serviceAccountUsernamePrefix is the prefix of the usernames service accounts authenticate with
+const serviceAccountUsernamePrefix = "system:serviceaccount:"
+
+// identityAllowlist lists the identities that may delete any namespace that is not protected without validation,
+// e.g. a cluster lifecycle controller or the on-call group.
+type identityAllowlist struct {
+	// Users are exact usernames.
+	Users []string `json:"users,omitempty"`
+	// Groups are group names, any of which the user has to be a member of.
+	Groups []string `json:"groups,omitempty"`
+	// ServiceAccounts are given as namespace/name, or namespace/* for every service account of a namespace.
+	ServiceAccounts []string `json:"serviceAccounts,omitempty"`
+}
+
+// validate checks the service accounts are given as namespace/name.
+func (a *identityAllowlist) validate() error {
+	for i, serviceAccount := range a.ServiceAccounts {
+		parts := strings.Split(serviceAccount, "/")
+		if len(parts) != 2 || parts[0] == "" || parts[1] == "" {
+			return fmt.Errorf("serviceAccounts[%d]: invalid service account %q, expected namespace/name or namespace/*", i, serviceAccount)
+		}
+	}
+	return nil
+}
+
+// match returns the allowlist entry the user matches, or false if it matches none.
+func (a *identityAllowlist) match(user authenticationv1.UserInfo) (string, bool) {
+	if containsString(a.Users, user.Username) {
+		return fmt.Sprintf("user %s", user.Username), true
+	}
+	for _, group := range user.Groups {
+		if containsString(a.Groups, group) {
+			return fmt.Sprintf("group %s", group), true
+		}
+	}
+	if strings.HasPrefix(user.Username, serviceAccountUsernamePrefix) {
+		parts := strings.Split(strings.TrimPrefix(user.Username, serviceAccountUsernamePrefix), ":")
+		if len(parts) == 2 {
+			for _, serviceAccount := range a.ServiceAccounts {
+				if serviceAccount == parts[0]+"/"+parts[1] || serviceAccount == parts[0]+"/*" {
+					return fmt.Sprintf("service account %s", serviceAccount), true
+				}
+			}
+		}
+	}
+	return "", false
+}
@@ -0,0 +1,98 @@
+// Copyright 2017 Yahoo Holdings Inc. 
+// Licensed under the terms of the 3-Clause BSD License.
+package main
+
+import (
+	"net/http/httptest"
+	"testing"
+
+	authenticationv1 "k8s.io/api/authentication/v1"
+	corev1 "k8s.io/api/core/v1"
+	"k8s.io/apimachinery/pkg/apis/meta/v1"
+	"k8s.io/client-go/kubernetes/fake"
+
+	"github.com/stretchr/testify/assert"
+)
+
+var testAllowlist = identityAllowlist{
+	Users:           []string{"lifecycle-admin"},
+	Groups:          []string{"sre-oncall"},
+	ServiceAccounts: []string{"platform/lifecycle-controller", "ci/*"},
+}
+
+func TestIdentityAllowlistMatch(t *testing.T) {
+	allowed := []struct {
+		user  authenticationv1.UserInfo
+		entry string
+	}{
+		{authenticationv1.UserInfo{Username: "lifecycle-admin"}, "user lifecycle-admin"},
+		{authenticationv1.UserInfo{Username: "jane", Groups: []string{"developers", "sre-oncall"}}, "group sre-oncall"},
+		{authenticationv1.UserInfo{Username: "system:serviceaccount:platform:lifecycle-controller"}, "service account platform/lifecycle-controller"},
+		{authenticationv1.UserInfo{Username: "system:serviceaccount:ci:deployer"}, "service account ci/*"},
+	}
+	for _, a := range allowed {
+		entry, ok := testAllowlist.match(a.user)
+		assert.True(t, ok, "%s should be allowlisted", a.user.Username)
+		assert.Equal(t, a.entry, entry)
+	}
+
+	for _, user := range []authenticationv1.UserInfo{
+		{Username: "jane", Groups: []string{"developers"}},
+		{Username: "system:serviceaccount:platform:default"},
+		{Username: "system:serviceaccount:platform-ci:deployer"},
+		{Username: "platform/lifecycle-controller"},
+	} {
+		_, ok := testAllowlist.match(user)
+		assert.False(t, ok, "%s should not be allowlisted", user.Username)
+	}
+}
+
+func TestAllowlistedIdentityWebhookHandler(t *testing.T) {
+	testPolicy := &policy{Allowlist: testAllowlist}
+	assert.Nil(t, testPolicy.validate(false), "Error should be nil")
+	defer activePolicy.Store(currentPolicy())
+	activePolicy.Store(testPolicy)
+
+	testPod := &corev1.Pod{
+		ObjectMeta: v1.ObjectMeta{
+			Name:      "test-pod",
+			Namespace: "test-namespace",
+		},
+	}
+	clientset = fake.NewSimpleClientset(testPod, cloneNamespace(templateNamespace))
+
+	testSpec := cloneAdmissionReview(templateAdmReview)
+	testSpec.Spec.UserInfo = authenticationv1.UserInfo{Username: "system:serviceaccount:platform:lifecycle-controller"}
+	rw := httptest.NewRecorder()
+	req := httptest.NewRequest("POST", "http://localhost:8080/", constructPostBody(testSpec))
+	webhookHandler(rw, req)
+
+	assert.True(t, getAdmissionReview(rw).Status.Allowed, "should approve the deletion of a non-empty namespace by an allowlisted identity")
+
+	testSpec.Spec.UserInfo = authenticationv1.UserInfo{Username: "jane", Groups: []string{"developers"}}
+	rw = httptest.NewRecorder()
+	req = httptest.NewRequest("POST", "http://localhost:8080/", constructPostBody(testSpec))
+	webhookHandler(rw, req)
+
+	assert.False(t, getAdmissionReview(rw).Status.Allowed, "should reject the deletion of a non-empty namespace by any other identity")
+}
+
+func TestAllowlistedIdentityProtectedWebhookHandler(t *testing.T) {
+	testPolicy := &policy{Allowlist: testAllowlist}
+	assert.Nil(t, testPolicy.validate(false), "Error should be nil")
+	defer activePolicy.Store(currentPolicy())
+	activePolicy.Store(testPolicy)
+
+	testNamespace := cloneNamespace(templateNamespace)
+	testNamespace.Name = "kube-public"
+	clientset = fake.NewSimpleClientset(testNamespace)
+
+	testSpec := cloneAdmissionReview(templateAdmReview)
+	testSpec.Spec.Name = "kube-public"
+	testSpec.Spec.UserInfo = authenticationv1.UserInfo{Username: "lifecycle-admin"}
+	rw := httptest.NewRecorder()
+	req := httptest.NewRequest("POST", "http://localhost:8080/", constructPostBody(testSpec))
+	webhookHandler(rw, req)
+
+	assert.False(t, getAdmissionReview(rw).Status.Allowed, "the allowlist should not apply to protected namespaces")
+}
@@ -0,0 +1,129 @@
+// Copyright 2017 Yahoo Holdings Inc. 
+// Licensed under the terms of the 3-Clause BSD License.
+package main
+
+import (
+	"errors"
+	"fmt"
+
+	"k8s.io/apimachinery/pkg/apis/meta/v1"
+	"k8s.io/apimachinery/pkg/labels"
+	"k8s.io/apimachinery/pkg/runtime/schema"
+)
+
+// builtinIgnoreRules match the objects Kubernetes provisions in every namespace, which never block a
+// deletion whatever the policy says: the default service account, its token secrets and the root CA bundle.
+var builtinIgnoreRules = []ignoreRule{
+	{Resource: "serviceaccounts", Names: []string{"default"}},
+	{Resource: "secrets", Annotations: map[string]string{"kubernetes.io/service-account.name": ""}},
+	{Resource: "configmaps", Names: []string{"kube-root-ca.crt"}},
+}
+
+func init() {
+	for i := range builtinIgnoreRules {
+		if err := builtinIgnoreRules[i].validate(); err != nil {
+			panic(fmt.Sprintf("invalid built-in ignore rule %d: %v", i, err))
+		}
+	}
+}
+
+// ignoreRule matches objects that are not counted, such as objects provisioned automatically.
+// An object is ignored when it matches every criterion of the rule.
+type ignoreRule struct {
+	// Resource is the group/resource the rule applies to, e.g. "configmaps" or "argoproj.io/*".
+	// A plain built-in name such as "deployments" stands for its group, apps/deployments.
+	Resource string `json:"resource"`
+	// Names are exact object names.
+	Names []string `json:"names,omitempty"`
+	// Selector is a label selector such as "app.kubernetes.io/managed-by=istio".
+	Selector string `json:"selector,omitempty"`
+	// Annotations maps annotation keys to their value, an empty value matching any value.
+	Annotations map[string]string `json:"annotations,omitempty"`
+	// OwnerKinds are the kinds of the owner references, e.g. "Certificate".
+	OwnerKinds []string `json:"ownerKinds,omitempty"`
+
+	groupResource schema.GroupResource
+	selector      labels.Selector
+}
+
+// validate checks the resource and the selector and prepares them for matching.
+func (r *ignoreRule) validate() error {
+	groupResources, err := parseGroupResources(r.Resource)
+	if err != nil || len(groupResources) != 1 {
+		return fmt.Errorf("invalid group/resource %q", r.Resource)
+	}
+	r.groupResource = resolveGroupResource(groupResources[0])
+	if len(r.Names) == 0 && r.Selector == "" && len(r.Annotations) == 0 && len(r.OwnerKinds) == 0 {
+		return errors.New("at least one of names, selector, annotations or ownerKinds is required, exclude the resource to ignore all of it")
+	}
+	r.selector = labels.Everything()
+	if r.Selector != "" {
+		selector, err := labels.Parse(r.Selector)
+		if err != nil {
+			return fmt.Errorf("invalid label selector %q: %v", r.Selector, err)
+		}
+		r.selector = selector
+	}
+	return nil
+}
+
+// matches returns true if object matches every criterion of the rule
+func (r *ignoreRule) matches(object v1.Object) bool {
+	if len(r.Names) > 0 && !containsString(r.Names, object.GetName()) {
+		return false
+	}
+	if r.selector != nil && !r.selector.Matches(labels.Set(object.GetLabels())) {
+		return false
+	}
+	annotations := object.GetAnnotations()
+	for key, value := range r.Annotations {
+		if actual, ok := annotations[key]; !ok || (value != "" && actual != value) {
+			return false
+		}
+	}
+	if len(r.OwnerKinds) > 0 {
+		owned := false
+		for _, owner := range object.GetOwnerReferences() {
+			if containsString(r.OwnerKinds, owner.Kind) {
+				owned = true
+				break
+			}
+		}
+		if !owned {
+			return false
+		}
+	}
+	return true
+}
+
+// ignoreRulesFor returns the built-in rules and the rules of the policy applying to groupResource
+func (p *policy) ignoreRulesFor(groupResource schema.GroupResource) []ignoreRule {
+	var rules []ignoreRule
+	for _, list := range [][]ignoreRule{builtinIgnoreRules, p.Ignore} {
+		for _, rule := range list {
+			if matchesGroupResource([]schema.GroupResource{rule.groupResource}, groupResource) {
+				rules = append(rules, rule)
+			}
+		}
+	}
+	return rules
+}
+
+// filterIgnored splits objects into those counted and those matching one of the rules
+func filterIgnored(rules []ignoreRule, objects []v1.Object) (counted, ignored []v1.Object) {
+	for _, object := range objects {
+		matched := false
+		for i := range rules {
+			if rules[i].matches(object) {
+				matched = true
+				break
+			}
+		}
+		if matched {
+			ignored = append(ignored, object)
+		} else {
+			counted = append(counted, object)
+		}
+	}
+	return counted, ignored
+}
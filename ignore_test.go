@@ -0,0 +1,162 @@
+// Copyright 2017 Yahoo Holdings Inc. 
+// Licensed under the terms of the 3-Clause BSD License.
+package main
+
+import (
+	"net/http/httptest"
+	"os"
+	"testing"
+
+	appsv1 "k8s.io/api/apps/v1"
+	corev1 "k8s.io/api/core/v1"
+	"k8s.io/apimachinery/pkg/apis/meta/v1"
+	"k8s.io/apimachinery/pkg/runtime"
+	"k8s.io/apimachinery/pkg/runtime/schema"
+	dynamicfake "k8s.io/client-go/dynamic/fake"
+	"k8s.io/client-go/kubernetes/fake"
+
+	"github.com/stretchr/testify/assert"
+)
+
+func TestBuiltinIgnoreRules(t *testing.T) {
+	p := &policy{}
+	assert.Nil(t, p.validate(false), "Error should be nil")
+
+	serviceAccounts, ignored := filterIgnored(p.ignoreRulesFor(schema.GroupResource{Resource: "serviceaccounts"}), []v1.Object{
+		&corev1.ServiceAccount{ObjectMeta: v1.ObjectMeta{Name: "default"}},
+		&corev1.ServiceAccount{ObjectMeta: v1.ObjectMeta{Name: "builder"}},
+	})
+	assert.Len(t, ignored, 1, "should ignore the default service account")
+	assert.Equal(t, "builder", serviceAccounts[0].GetName())
+
+	secrets, _ := filterIgnored(p.ignoreRulesFor(schema.GroupResource{Resource: "secrets"}), []v1.Object{
+		&corev1.Secret{ObjectMeta: v1.ObjectMeta{Name: "default-token-x7k2p", Annotations: map[string]string{"kubernetes.io/service-account.name": "default"}}},
+		&corev1.Secret{ObjectMeta: v1.ObjectMeta{Name: "db-password"}},
+	})
+	assert.Len(t, secrets, 1, "should ignore the service account tokens")
+	assert.Equal(t, "db-password", secrets[0].GetName())
+
+	configMaps, _ := filterIgnored(p.ignoreRulesFor(schema.GroupResource{Resource: "configmaps"}), []v1.Object{
+		&corev1.ConfigMap{ObjectMeta: v1.ObjectMeta{Name: "kube-root-ca.crt"}},
+	})
+	assert.Empty(t, configMaps, "should ignore the root CA bundle")
+
+	assert.Empty(t, p.ignoreRulesFor(schema.GroupResource{Resource: "pods"}), "no built-in rule applies to pods")
+}
+
+func TestPolicyIgnoreRules(t *testing.T) {
+	filename := writePolicyFile(`
+ignore:
+- resource: configmaps
+  names: [istio-ca-root-cert]
+- resource: secrets
+  selector: app.kubernetes.io/managed-by=cert-manager
+- resource: secrets
+  annotations:
+    cert-manager.io/issuer-name: ""
+- resource: pods
+  ownerKinds: [Job]
+`)
+	defer os.Remove(filename)
+	p, err := loadPolicy(filename, false)
+	assert.Nil(t, err, "Error should be nil")
+
+	_, ignored := filterIgnored(p.ignoreRulesFor(schema.GroupResource{Resource: "configmaps"}), []v1.Object{
+		&corev1.ConfigMap{ObjectMeta: v1.ObjectMeta{Name: "istio-ca-root-cert"}},
+		&corev1.ConfigMap{ObjectMeta: v1.ObjectMeta{Name: "kube-root-ca.crt"}},
+		&corev1.ConfigMap{ObjectMeta: v1.ObjectMeta{Name: "settings"}},
+	})
+	assert.Len(t, ignored, 2, "should ignore by name on top of the built-in rules")
+
+	counted, _ := filterIgnored(p.ignoreRulesFor(schema.GroupResource{Resource: "secrets"}), []v1.Object{
+		&corev1.Secret{ObjectMeta: v1.ObjectMeta{Name: "tls", Labels: map[string]string{"app.kubernetes.io/managed-by": "cert-manager"}}},
+		&corev1.Secret{ObjectMeta: v1.ObjectMeta{Name: "issued", Annotations: map[string]string{"cert-manager.io/issuer-name": "letsencrypt"}}},
+		&corev1.Secret{ObjectMeta: v1.ObjectMeta{Name: "db-password", Labels: map[string]string{"app.kubernetes.io/managed-by": "helm"}}},
+	})
+	if assert.Len(t, counted, 1, "should ignore by label and annotation") {
+		assert.Equal(t, "db-password", counted[0].GetName())
+	}
+
+	counted, _ = filterIgnored(p.ignoreRulesFor(schema.GroupResource{Resource: "pods"}), []v1.Object{
+		&corev1.Pod{ObjectMeta: v1.ObjectMeta{Name: "migrate-x7k2p", OwnerReferences: []v1.OwnerReference{{Kind: "Job", Name: "migrate"}}}},
+		&corev1.Pod{ObjectMeta: v1.ObjectMeta{Name: "web-5d8f7", OwnerReferences: []v1.OwnerReference{{Kind: "ReplicaSet", Name: "web"}}}},
+	})
+	if assert.Len(t, counted, 1, "should ignore by owner kind") {
+		assert.Equal(t, "web-5d8f7", counted[0].GetName())
+	}
+}
+
+func TestPolicyIgnoreRulesBuiltinName(t *testing.T) {
+	filename := writePolicyFile(`
+ignore:
+- resource: deployments
+  names: [keeper]
+`)
+	defer os.Remove(filename)
+	p, err := loadPolicy(filename, true)
+	assert.Nil(t, err, "Error should be nil")
+
+	counted, _ := filterIgnored(p.ignoreRulesFor(schema.GroupResource{Group: "apps", Resource: "deployments"}), []v1.Object{
+		&appsv1.Deployment{ObjectMeta: v1.ObjectMeta{Name: "keeper"}},
+		&appsv1.Deployment{ObjectMeta: v1.ObjectMeta{Name: "web"}},
+	})
+	if assert.Len(t, counted, 1, "a plain built-in name should match the resource of its group") {
+		assert.Equal(t, "web", counted[0].GetName())
+	}
+}
+
+func TestInvalidIgnoreRules(t *testing.T) {
+	invalidPolicies := []struct {
+		content  string
+		errorMsg string
+	}{
+		{"ignore:\n- resource: configmaps\n", "ignore[0]: at least one of names, selector, annotations or ownerKinds is required"},
+		{"ignore:\n- resource: apps/v1/deployments\n  names: [web]\n", `ignore[0]: invalid group/resource "apps/v1/deployments"`},
+		{"ignore:\n- resource: secrets\n  selector: \"a b\"\n", `ignore[0]: invalid label selector "a b"`},
+	}
+
+	for _, invalidPolicy := range invalidPolicies {
+		filename := writePolicyFile(invalidPolicy.content)
+		_, err := loadPolicy(filename, false)
+		os.Remove(filename)
+
+		assert.NotNil(t, err, "should reject the policy %q", invalidPolicy.content)
+		if err != nil {
+			assert.Contains(t, err.Error(), invalidPolicy.errorMsg)
+		}
+	}
+}
+
+func TestIgnoreWebhookHandler(t *testing.T) {
+	filename := writePolicyFile("resources:\n- resource: serviceaccounts\n- resource: secrets\n")
+	defer os.Remove(filename)
+	testPolicy, err := loadPolicy(filename, false)
+	assert.Nil(t, err, "Error should be nil")
+	defer activePolicy.Store(currentPolicy())
+	activePolicy.Store(testPolicy)
+
+	clientset = fake.NewSimpleClientset(cloneNamespace(templateNamespace))
+	token := newUnstructured("v1", "Secret", "test-namespace", "default-token-x7k2p")
+	token.SetAnnotations(map[string]string{"kubernetes.io/service-account.name": "default"})
+	dynamicClient = dynamicfake.NewSimpleDynamicClient(runtime.NewScheme(),
+		newUnstructured("v1", "ServiceAccount", "test-namespace", "default"),
+		token,
+	)
+
+	rw := httptest.NewRecorder()
+	req := httptest.NewRequest("POST", "http://localhost:8080/", constructPostBody(cloneAdmissionReview(templateAdmReview)))
+	webhookHandler(rw, req)
+	assert.True(t, getAdmissionReview(rw).Status.Allowed, "should approve if the namespace only holds provisioned objects")
+
+	dynamicClient = dynamicfake.NewSimpleDynamicClient(runtime.NewScheme(),
+		newUnstructured("v1", "ServiceAccount", "test-namespace", "default"),
+		newUnstructured("v1", "ServiceAccount", "test-namespace", "builder"),
+	)
+	rw = httptest.NewRecorder()
+	req = httptest.NewRequest("POST", "http://localhost:8080/", constructPostBody(cloneAdmissionReview(templateAdmReview)))
+	webhookHandler(rw, req)
+
+	admReview := getAdmissionReview(rw)
+	assert.False(t, admReview.Status.Allowed, "should reject if other service accounts remain")
+	assert.Contains(t, admReview.Status.Result.Reason, "[serviceaccounts(1)]")
+}
@@ -5,44 +5,60 @@ package main
 import (
 	"bytes"
 	"encoding/json"
-	"errors"
 	"fmt"
 	"io"
 	"net/http"
+	"sort"
+	"strings"
+	"time"
 
-	"k8s.io/api/admission/v1alpha1"
+	"github.com/Sirupsen/logrus"
+	admissionv1beta1 "k8s.io/api/admission/v1beta1"
+	corev1 "k8s.io/api/core/v1"
 	apiErrors "k8s.io/apimachinery/pkg/api/errors"
 	"k8s.io/apimachinery/pkg/apis/meta/v1"
+	"k8s.io/apimachinery/pkg/runtime/schema"
 )
 
 const (
 	bypassAnnotationKey = "k8s-namespace-guard.admission.yahoo.com/allow-cascade-delete"
+
+	// causeTypeBlockingResources is the type of the status causes listing the resources blocking a deletion
+	causeTypeBlockingResources v1.CauseType = "BlockingResources"
+
+	// --onTimeout values, rejecting (failing closed) or allowing (failing open) deletions that could not be validated in time
+	onTimeoutReject = "reject"
+	onTimeoutAllow  = "allow"
 )
 
 var (
 	namespaceResourceType = v1.GroupVersionResource{Group: "", Version: "v1", Resource: "namespaces"}
 )
 
-// writeResponse writes the admissionReviewStatus object to the response body
-func writeResponse(rw http.ResponseWriter, admReview *v1alpha1.AdmissionReview, allowed bool, errorMsg string) {
-	log.Infof("Responding Allowed: %t for %s on Namespace: %s by user: %s", allowed,
-		admReview.Spec.Operation,
-		admReview.Spec.Name,
-		admReview.Spec.UserInfo.Username)
-
+// writeResponse writes the admission verdict to the response body in the apiVersion of the review
+func writeResponse(rw http.ResponseWriter, review *reviewRequest, allowed bool, errorMsg string) {
+	decision := "allowed"
 	if !allowed {
-		log.Errorf("Rejection reason: %s", errorMsg)
+		decision = "rejected"
 	}
-
-	admReview.Status = v1alpha1.AdmissionReviewStatus{
-		Allowed: allowed,
-		Result: &v1.Status{
-			Reason: v1.StatusReason(errorMsg),
-		},
+	entry := review.logger().WithFields(logrus.Fields{
+		"decision": decision,
+		"reason":   review.reason,
+	})
+	if !review.start.IsZero() {
+		entry = entry.WithField("duration", time.Since(review.start).String())
 	}
+	if allowed {
+		entry.Info("Responding to the admission review")
+	} else {
+		entry.WithField("message", errorMsg).Error("Responding to the admission review")
+	}
+
+	recordDecision(review, allowed)
+	auditDecision(review, allowed, errorMsg)
 
 	body := new(bytes.Buffer)
-	err := json.NewEncoder(body).Encode(admReview)
+	err := json.NewEncoder(body).Encode(encodeReviewResponse(review, allowed, errorMsg))
 	if err != nil {
 		io.WriteString(rw, "Error occurred while encoding the admission review status into json: "+err.Error())
 		return
@@ -50,118 +66,476 @@ func writeResponse(rw http.ResponseWriter, admReview *v1alpha1.AdmissionReview,
 	rw.Write(body.Bytes())
 }
 
-func podCounter(namespace string) (int, error) {
+func podCounter(namespace string) ([]v1.Object, error) {
 	list, err := clientset.CoreV1().Pods(namespace).List(v1.ListOptions{})
 	if err != nil {
-		return 0, err
+		return nil, err
 	}
-	return len(list.Items), nil
+	objects := make([]v1.Object, len(list.Items))
+	for i := range list.Items {
+		objects[i] = &list.Items[i]
+	}
+	return objects, nil
 }
 
-func serviceCounter(namespace string) (int, error) {
+func serviceCounter(namespace string) ([]v1.Object, error) {
 	list, err := clientset.CoreV1().Services(namespace).List(v1.ListOptions{})
 	if err != nil {
-		return 0, err
+		return nil, err
+	}
+	objects := make([]v1.Object, len(list.Items))
+	for i := range list.Items {
+		objects[i] = &list.Items[i]
 	}
-	return len(list.Items), nil
+	return objects, nil
 }
 
-func replicasetCounter(namespace string) (int, error) {
-	list, err := clientset.ExtensionsV1beta1().ReplicaSets(namespace).List(v1.ListOptions{})
+func replicasetCounter(namespace string) ([]v1.Object, error) {
+	list, err := clientset.AppsV1().ReplicaSets(namespace).List(v1.ListOptions{})
 	if err != nil {
-		return 0, err
+		return nil, err
 	}
-	return len(list.Items), nil
+	objects := make([]v1.Object, len(list.Items))
+	for i := range list.Items {
+		objects[i] = &list.Items[i]
+	}
+	return objects, nil
 }
 
-func deploymentCounter(namespace string) (int, error) {
-	list, err := clientset.AppsV1beta1().Deployments(namespace).List(v1.ListOptions{})
+func deploymentCounter(namespace string) ([]v1.Object, error) {
+	list, err := clientset.AppsV1().Deployments(namespace).List(v1.ListOptions{})
 	if err != nil {
-		return 0, err
+		return nil, err
+	}
+	objects := make([]v1.Object, len(list.Items))
+	for i := range list.Items {
+		objects[i] = &list.Items[i]
 	}
-	return len(list.Items), nil
+	return objects, nil
 }
 
-func statefulsetCounter(namespace string) (int, error) {
-	list, err := clientset.AppsV1beta1().StatefulSets(namespace).List(v1.ListOptions{})
+func statefulsetCounter(namespace string) ([]v1.Object, error) {
+	list, err := clientset.AppsV1().StatefulSets(namespace).List(v1.ListOptions{})
 	if err != nil {
-		return 0, err
+		return nil, err
 	}
-	return len(list.Items), nil
+	objects := make([]v1.Object, len(list.Items))
+	for i := range list.Items {
+		objects[i] = &list.Items[i]
+	}
+	return objects, nil
 }
 
-func daemonsetCounter(namespace string) (int, error) {
-	list, err := clientset.ExtensionsV1beta1().DaemonSets(namespace).List(v1.ListOptions{})
+func daemonsetCounter(namespace string) ([]v1.Object, error) {
+	list, err := clientset.AppsV1().DaemonSets(namespace).List(v1.ListOptions{})
 	if err != nil {
-		return 0, err
+		return nil, err
+	}
+	objects := make([]v1.Object, len(list.Items))
+	for i := range list.Items {
+		objects[i] = &list.Items[i]
 	}
-	return len(list.Items), nil
+	return objects, nil
 }
 
-func ingressCounter(namespace string) (int, error) {
+func ingressCounter(namespace string) ([]v1.Object, error) {
 	list, err := clientset.ExtensionsV1beta1().Ingresses(namespace).List(v1.ListOptions{})
 	if err != nil {
-		return 0, err
+		return nil, err
 	}
-	return len(list.Items), nil
+	objects := make([]v1.Object, len(list.Items))
+	for i := range list.Items {
+		objects[i] = &list.Items[i]
+	}
+	return objects, nil
 }
 
-func autoScaleCounter(namespace string) (int, error) {
+func autoScaleCounter(namespace string) ([]v1.Object, error) {
 	list, err := clientset.AutoscalingV1().HorizontalPodAutoscalers(namespace).List(v1.ListOptions{})
 	if err != nil {
-		return 0, err
+		return nil, err
+	}
+	objects := make([]v1.Object, len(list.Items))
+	for i := range list.Items {
+		objects[i] = &list.Items[i]
 	}
-	return len(list.Items), nil
+	return objects, nil
+}
+
+// resourceCounter counts the resources of one kind in a namespace, which counter lists.
+// The namespace deletion is blocked when the count exceeds the threshold, or by any resource of a risk check.
+// Resource types found through discovery but not named in the policy are skipped if listing them is forbidden.
+type resourceCounter struct {
+	kind          string
+	gvr           schema.GroupVersionResource
+	counter       func(namespace string) ([]v1.Object, error)
+	threshold     int
+	risk          *riskCheck
+	skipForbidden bool
 }
 
-// validateNamespaceDeletion returns an error if the namespace contains any workload resources
-func validateNamespaceDeletion(namespace string) (err error) {
+// staticCounters are the workload resources checked when discovery mode is disabled
+var staticCounters = []resourceCounter{
+	{kind: "pods", gvr: schema.GroupVersionResource{Group: "", Version: "v1", Resource: "pods"}, counter: podCounter},
+	{kind: "services", gvr: schema.GroupVersionResource{Group: "", Version: "v1", Resource: "services"}, counter: serviceCounter},
+	{kind: "replicasets", gvr: schema.GroupVersionResource{Group: "apps", Version: "v1", Resource: "replicasets"}, counter: replicasetCounter},
+	{kind: "deployments", gvr: schema.GroupVersionResource{Group: "apps", Version: "v1", Resource: "deployments"}, counter: deploymentCounter},
+	{kind: "statefulsets", gvr: schema.GroupVersionResource{Group: "apps", Version: "v1", Resource: "statefulsets"}, counter: statefulsetCounter},
+	{kind: "daemonsets", gvr: schema.GroupVersionResource{Group: "apps", Version: "v1", Resource: "daemonsets"}, counter: daemonsetCounter},
+	{kind: "ingresses", gvr: schema.GroupVersionResource{Group: "extensions", Version: "v1beta1", Resource: "ingresses"}, counter: ingressCounter},
+	{kind: "horizontalpodautoscalers", gvr: schema.GroupVersionResource{Group: "autoscaling", Version: "v1", Resource: "horizontalpodautoscalers"}, counter: autoScaleCounter},
+}
 
-	counters := []struct {
-		kind    string
-		counter func(namespace string) (int, error)
-	}{
-		{"pods", podCounter},
-		{"services", serviceCounter},
-		{"replicasets", replicasetCounter},
-		{"deployments", deploymentCounter},
-		{"statefulsets", statefulsetCounter},
-		{"daemonsets", daemonsetCounter},
-		{"ingresses", ingressCounter},
-		{"horizontalpodautoscalers", autoScaleCounter},
+// list returns the resources in namespace that are counted, along with their number.
+// objects may hold fewer than count resources when only a page of them was listed.
+func (c resourceCounter) list(namespace string) ([]v1.Object, int, error) {
+	if c.risk != nil {
+		start := time.Now()
+		objects, err := c.counter(namespace)
+		observeList(c.kind, start, err)
+		return objects, len(objects), err
+	}
+	p := currentPolicy()
+	groupResource := c.gvr.GroupResource()
+	// owners are only found among whole lists
+	objects, count, err := c.fetch(namespace, !*ownerRollUp, false)
+	// skipping objects only lowers the count, so a page of metadata is enough unless it blocks the deletion
+	if err != nil || count <= c.threshold || !p.filtersObjects(groupResource) {
+		return objects, count, err
+	}
+	withStatus := p.Counting.filtersPhases(groupResource)
+	// the apiserver may answer with an empty first page along with a continue token, every resource is listed then
+	metadataOnly := false
+	if len(objects) > 0 {
+		_, metadataOnly = objects[0].(*v1.PartialObjectMetadata)
+	}
+	if len(objects) < count || (withStatus && metadataOnly) {
+		if objects, count, err = c.fetch(namespace, false, withStatus); err != nil {
+			return objects, count, err
+		}
 	}
 
+	counted, skipped := p.filterObjects(groupResource, objects)
+	for reason, objects := range skipped {
+		log.WithFields(logrus.Fields{
+			"namespace": namespace,
+			"kind":      c.kind,
+			"skipped":   reason,
+			"count":     len(objects),
+			"names":     formatNames(objects, len(objects), len(objects)),
+		}).Debug("Not counting the skipped resources")
+	}
+	return counted, len(counted), nil
+}
+
+// fetch returns the resources in namespace along with their number, answering from the informer cache when it is
+// enabled and fresh, and listing from the apiserver otherwise. With --metadataLists only the metadata is listed,
+// of the first page if paged, so objects may hold fewer than count resources, unless withStatus requires whole objects.
+func (c resourceCounter) fetch(namespace string, paged, withStatus bool) (objects []v1.Object, count int, err error) {
+	if objectCache != nil {
+		if objects, ok := objectCache.objects(c.gvr, namespace); ok {
+			return objects, len(objects), nil
+		}
+	}
+	if metadataClient != nil && !withStatus {
+		var limit int64
+		if paged {
+			limit = metadataPageSize()
+		}
+		start := time.Now()
+		objects, count, complete, err := listMetadata(c.gvr, namespace, limit)
+		observeList(c.kind, start, err)
+		if err != nil || complete {
+			return objects, count, err
+		}
+		log.WithFields(logrus.Fields{
+			"namespace": namespace,
+			"kind":      c.kind,
+		}).Debug("The apiserver did not report the number of remaining resources, listing all of them")
+	}
+	start := time.Now()
+	objects, err = c.counter(namespace)
+	observeList(c.kind, start, err)
+	return objects, len(objects), err
+}
+
+// truncateNames returns the sorted names of up to max objects, and the number of the others out of count.
+func truncateNames(objects []v1.Object, count, max int) (names []string, more int) {
+	names = make([]string, len(objects))
+	for i, object := range objects {
+		names[i] = object.GetName()
+	}
+	sort.Strings(names)
+	if len(names) > max {
+		names = names[:max]
+	}
+	return names, count - len(names)
+}
+
+// formatNames returns the sorted names of up to max objects, followed by the number of the others out of count.
+func formatNames(objects []v1.Object, count, max int) string {
+	names, more := truncateNames(objects, count, max)
+	if more == 0 {
+		return strings.Join(names, ", ")
+	}
+	return fmt.Sprintf("%s and %d more", strings.Join(names, ", "), more)
+}
+
+// validationError rejects a namespace deletion, with one cause per kind of resources blocking it.
+// The message is rendered from the templates of the current policy with data. reason is the
+// decision reason recorded for the rejection, and rule the thresholds and checks that decided it.
+type validationError struct {
+	data   *messageData
+	causes []v1.StatusCause
+	reason string
+	rule   string
+}
+
+func (e *validationError) Error() string {
+	return currentPolicy().Messages.rejectionMessage(e.data)
+}
+
+// checkedCounters returns the counters of the resource types that block a namespace deletion
+func checkedCounters() ([]resourceCounter, error) {
+	return currentPolicy().counters(*discoveryMode)
+}
+
+// listResult is the outcome of listing the resources of the counter at index
+type listResult struct {
+	index   int
+	objects []v1.Object
+	count   int
+	err     error
+}
+
+// listAll lists the resources of every counter in namespace, running up to --listConcurrency lists at once.
+// Lists that did not finish within timeout are left running, results holds nil for them and timedOut their kinds.
+// A timeout of 0 waits for every list.
+func listAll(counters []resourceCounter, namespace string, timeout time.Duration) (results []*listResult, timedOut []string) {
+	results = make([]*listResult, len(counters))
+	done := make(chan *listResult, len(counters))
+	stop := make(chan struct{})
+	defer close(stop)
+	slots := make(chan struct{}, *listWorkers)
+
+	for i, c := range counters {
+		go func(i int, c resourceCounter) {
+			select {
+			case slots <- struct{}{}:
+			case <-stop:
+				return
+			}
+			defer func() { <-slots }()
+			objects, count, err := c.list(namespace)
+			done <- &listResult{index: i, objects: objects, count: count, err: err}
+		}(i, c)
+	}
+
+	var deadline <-chan time.Time
+	if timeout > 0 {
+		timer := time.NewTimer(timeout)
+		defer timer.Stop()
+		deadline = timer.C
+	}
+	for pending := len(counters); pending > 0; pending-- {
+		select {
+		case result := <-done:
+			results[result.index] = result
+		case <-deadline:
+			for i, result := range results {
+				if result == nil {
+					timedOut = append(timedOut, counters[i].kind)
+				}
+			}
+			return results, timedOut
+		}
+	}
+	return results, nil
+}
+
+// validateNamespaceDeletion returns an error if the namespace contains any workload resources,
+// along with the number of resources of every checked kind. The kinds that could not be counted
+// within timeout are returned in timedOut, they fail the validation unless --onTimeout=allow.
+// The risk checks whose own bypass annotation is set in annotations are skipped, and the references
+// from other namespaces that only warn are returned in warnings.
+func validateNamespaceDeletion(namespace string, annotations map[string]string, timeout time.Duration) (counts map[string]int, timedOut, warnings []string, err error) {
 	var errList []error
-	var nonEmptyList []string
+	counters, err := checkedCounters()
+	if err != nil {
+		errList = append(errList, fmt.Errorf("error discovering namespaced resources, %v", err))
+	}
+	return countResources(namespace, append(counters, riskCounters(annotations, false)...), timeout, errList)
+}
+
+// validateBypassedDeletion returns an error if the risk checks that the bypass annotation does not cover
+// find resources in the namespace, unless their own bypass annotation is set in annotations.
+func validateBypassedDeletion(namespace string, annotations map[string]string, timeout time.Duration) (timedOut []string, err error) {
+	_, timedOut, _, err = countResources(namespace, riskCounters(annotations, true), timeout, nil)
+	return timedOut, err
+}
+
+// countResources lists the resources of counters in namespace, returning the number of resources of
+// every kind and an error if any of them block the deletion or errList holds earlier errors. The
+// resources found by the risk checks that only warn are described in warnings.
+func countResources(namespace string, counters []resourceCounter, timeout time.Duration, errList []error) (counts map[string]int, timedOut, warnings []string, err error) {
+	var remainingList []string
+	var causes []v1.StatusCause
+	data := newMessageData(namespace, "", nil)
+	counts = map[string]int{}
+
+	results, timedOut := listAll(counters, namespace, timeout)
+	if len(timedOut) > 0 && *onTimeout == onTimeoutReject {
+		errList = append(errList, fmt.Errorf("timed out after %s listing %v", timeout, timedOut))
+	}
 
-	for _, c := range counters {
-		num, err := c.counter(namespace)
+	var blockingKinds []blockingKind
+	var listed []listedObject
+	var exceeded, risks []string
+	var riskReason string
+	for i, c := range counters {
+		if results[i] == nil {
+			continue
+		}
+		objects, num, err := results[i].objects, results[i].count, results[i].err
+		if err != nil && c.skipForbidden && apiErrors.IsForbidden(err) {
+			log.WithFields(logrus.Fields{
+				"namespace": namespace,
+				"resource":  c.kind,
+			}).Warnf("Skipping the discovered resource type the guard may not list: %s", err.Error())
+			continue
+		}
 		if err != nil {
 			errList = append(errList, fmt.Errorf("error listing %s, %v", c.kind, err))
 			continue
 		}
-		if num > 0 {
-			nonEmptyList = append(nonEmptyList, fmt.Sprintf("%s(%d)", c.kind, num))
+		if c.risk != nil {
+			if num == 0 {
+				continue
+			}
+			finding := newRiskFinding(c, objects)
+			if c.risk.warn {
+				warnings = append(warnings, fmt.Sprintf("The namespace %s %s: %s.", namespace, finding.Description, strings.Join(finding.Objects, ", ")))
+				continue
+			}
+			data.Risks = append(data.Risks, finding)
+			risks = append(risks, c.kind)
+			if riskReason == "" {
+				riskReason = c.risk.reason
+			}
+			causes = append(causes, v1.StatusCause{Type: c.risk.causeType, Field: c.kind, Message: strings.Join(finding.Objects, ", ")})
+			continue
+		}
+		counts[c.kind] = num
+		for _, object := range objects {
+			listed = append(listed, listedObject{kind: c.kind, object: object})
+		}
+		if num > c.threshold {
+			blockingKinds = append(blockingKinds, blockingKind{Kind: c.kind, Count: num, objects: objects})
+			exceeded = append(exceeded, fmt.Sprintf("%s(%d) > %d", c.kind, num, c.threshold))
+		}
+	}
+	if *ownerRollUp {
+		blockingKinds = rollUpOwners(blockingKinds, listed)
+	}
+
+	for _, blocking := range blockingKinds {
+		data.Resources = append(data.Resources, fmt.Sprintf("%s(%d)", blocking.Kind, blocking.Count))
+		cause := v1.StatusCause{Type: causeTypeBlockingResources, Field: blocking.Kind, Message: fmt.Sprintf("%d %s", blocking.Count, blocking.Kind)}
+		if *maxObjectNames > 0 {
+			blocking.Names, blocking.More = truncateNames(blocking.objects, blocking.Count, *maxObjectNames)
+			names := formatNames(blocking.objects, blocking.Count, *maxObjectNames)
+			if len(blocking.Dependents) > 0 {
+				names += fmt.Sprintf(" (owning %s)", formatDependents(blocking.Dependents))
+			}
+			remainingList = append(remainingList, fmt.Sprintf("%s: %s", blocking.Kind, names))
+			cause.Message += ": " + names
+		} else if len(blocking.Dependents) > 0 {
+			cause.Message += fmt.Sprintf(" owning %s", formatDependents(blocking.Dependents))
+		}
+		data.Blocking = append(data.Blocking, blocking)
+		causes = append(causes, cause)
+	}
+
+	data.Remaining = strings.Join(remainingList, "; ")
+	for _, err := range errList {
+		data.Errors = append(data.Errors, err.Error())
+	}
+	// the resources found decide the rejection over the kinds that could not be counted, and
+	// those of the risk checks over the thresholds
+	var rules []string
+	if len(exceeded) > 0 {
+		rules = append(rules, "thresholds exceeded: "+strings.Join(exceeded, ", "))
+	}
+	if len(risks) > 0 {
+		rules = append(rules, "risk checks: "+strings.Join(risks, ", "))
+	}
+	reason := reasonNotEmpty
+	if riskReason != "" {
+		reason = riskReason
+	}
+	if len(data.Resources) == 0 && len(data.Risks) == 0 {
+		reason = reasonError
+		if len(timedOut) > 0 && *onTimeout == onTimeoutReject {
+			reason = reasonTimeout
+			rules = append(rules, "onTimeout "+onTimeoutReject)
 		}
 	}
+	if len(data.Resources) > 0 || len(data.Risks) > 0 || len(data.Errors) > 0 {
+		return counts, timedOut, warnings, &validationError{data: data, causes: causes, reason: reason, rule: strings.Join(rules, "; ")}
+	}
+	return counts, timedOut, warnings, nil
+}
 
-	errStr := ""
-	if len(nonEmptyList) > 0 {
-		errStr += fmt.Sprintf("The namespace %s you are trying to remove contains one or more of these resources: %v. Please delete them and try again.", namespace, nonEmptyList)
+// validationTimeout returns how long the resources may be counted for a review received at start. The
+// apiserver sends its webhook timeout as the timeout query parameter, a tenth of which is kept to answer.
+func validationTimeout(req *http.Request, start time.Time) time.Duration {
+	timeout := *countTimeout
+	if requestTimeout, err := time.ParseDuration(req.URL.Query().Get("timeout")); err == nil && requestTimeout > 0 {
+		if requestTimeout = requestTimeout - requestTimeout/10; timeout == 0 || requestTimeout < timeout {
+			timeout = requestTimeout
+		}
 	}
-	if len(errList) > 0 {
-		errStr += fmt.Sprintf("The following error(s) occurred while validating the DELETE operation on the namespace %s: %v.", namespace, errList)
+	if timeout == 0 {
+		return 0
 	}
-	if errStr != "" {
-		errStr += fmt.Sprintf(" WARNING: If you know what you are doing, run `kubectl annotate namespace %s %s=true` to bypass this policy check.", namespace, bypassAnnotationKey)
-		return errors.New(errStr)
+	if remaining := timeout - time.Since(start); remaining > 0 {
+		return remaining
 	}
-	return nil
+	// out of time already, give the cached counts a chance
+	return time.Millisecond
+}
+
+// warnTimedOut logs and warns about the kinds that could not be counted within timeout, which do not
+// block the deletion with --onTimeout=allow.
+func warnTimedOut(review *reviewRequest, timedOut []string, timeout time.Duration) {
+	review.logger().WithFields(logrus.Fields{
+		"timedOut":  timedOut,
+		"timeout":   timeout.String(),
+		"onTimeout": onTimeoutAllow,
+	}).Warn("Counting timed out. OK to DELETE.")
+	review.warnings = append(review.warnings, fmt.Sprintf("k8s-namespace-guard could not check %v within %s and allowed this deletion", timedOut, timeout))
+}
+
+// admitWithoutValidation allows the review as --admitAll is set, recording an event on the namespace for deletions
+func admitWithoutValidation(rw http.ResponseWriter, review *reviewRequest, namespace *corev1.Namespace) {
+	review.logger().Warn("admitAll flag is set to true. Allowing Namespace admission review request to pass without validation.")
+	if review.Resource == namespaceResourceType && review.Operation == admissionv1beta1.Delete {
+		recordNamespaceEvent(review, namespace, corev1.EventTypeWarning, eventDeletionAdmitted,
+			"Deletion requested by user %s allowed without validation because admitAll is set", review.UserInfo.Username)
+	}
+	review.reason = reasonAdmitAll
+	writeResponse(rw, review, true, "")
 }
 
 // webhookHandler handles the namespace deletion guard admission webhook
 func webhookHandler(rw http.ResponseWriter, req *http.Request) {
-	log.Infof("Serving %s %s request for client: %s", req.Method, req.URL.Path, req.RemoteAddr)
+	start := time.Now()
+	defer observeWebhookDuration(start)
+	log.WithFields(logrus.Fields{
+		"method": req.Method,
+		"path":   req.URL.Path,
+		"client": req.RemoteAddr,
+	}).Info("Serving the admission webhook request")
 
 	if req.Method != http.MethodPost {
 		http.Error(rw, fmt.Sprintf("Incoming request method %s is not supported, only POST is supported", req.Method), http.StatusMethodNotAllowed)
@@ -173,61 +547,191 @@ func webhookHandler(rw http.ResponseWriter, req *http.Request) {
 		return
 	}
 
-	admReview := v1alpha1.AdmissionReview{}
-	err := json.NewDecoder(req.Body).Decode(&admReview)
+	review, err := decodeReviewRequest(req.Body)
+	review.start = start
 	if err != nil {
 		errorMsg := fmt.Sprintf("Failed to decode the request body json into an AdmissionReview resource: %s", err.Error())
-		writeResponse(rw, &v1alpha1.AdmissionReview{}, false, errorMsg)
+		review.reason = reasonInvalidRequest
+		writeResponse(rw, review, false, errorMsg)
+		return
+	}
+	review.logger().WithFields(logrus.Fields{
+		"apiVersion": review.apiVersion,
+		"resource":   review.Resource,
+		"kind":       review.Kind,
+	}).Debug("Incoming AdmissionReview")
+
+	// namespace deletions are only admitted once the namespace is known not to be protected
+	if *admitAll == true && (review.Resource != namespaceResourceType || review.Operation != admissionv1beta1.Delete) {
+		admitWithoutValidation(rw, review, nil)
 		return
 	}
-	log.Debugf("Incoming AdmissionReview for %s on resource: %v, kind: %v", admReview.Spec.Operation, admReview.Spec.Resource, admReview.Spec.Kind)
 
-	if *admitAll == true {
-		log.Warnf("admitAll flag is set to true. Allowing Namespace admission review request to pass without validation.")
-		writeResponse(rw, &admReview, true, "")
+	if review.Resource != namespaceResourceType {
+		errorMsg := fmt.Sprintf("Incoming resource is not a Namespace: %v", review.Resource)
+		review.reason = reasonInvalidRequest
+		writeResponse(rw, review, false, errorMsg)
 		return
 	}
 
-	if admReview.Spec.Resource != namespaceResourceType {
-		errorMsg := fmt.Sprintf("Incoming resource is not a Namespace: %v", admReview.Spec.Resource)
-		writeResponse(rw, &admReview, false, errorMsg)
+	if review.Operation == admissionv1beta1.Create || review.Operation == admissionv1beta1.Update {
+		if err := validateNamespaceChange(review); err != nil {
+			review.reason = reasonBypassDenied
+			writeResponse(rw, review, false, err.Error())
+			return
+		}
+		review.reason = reasonUpdate
+		if review.Operation == admissionv1beta1.Create {
+			review.reason = reasonCreate
+		}
+		writeResponse(rw, review, true, "")
 		return
 	}
 
-	if admReview.Spec.Operation != v1alpha1.Delete {
-		errorMsg := fmt.Sprintf("Incoming operation is %v on namespace %s. Only DELETE is currently supported.", admReview.Spec.Operation, admReview.Spec.Name)
-		writeResponse(rw, &admReview, false, errorMsg)
+	if review.Operation != admissionv1beta1.Delete {
+		errorMsg := fmt.Sprintf("Incoming operation is %v on namespace %s. Only CREATE, UPDATE and DELETE are currently supported.", review.Operation, review.Name)
+		review.reason = reasonInvalidRequest
+		writeResponse(rw, review, false, errorMsg)
 		return
 	}
 
-	namespace, err := clientset.CoreV1().Namespaces().Get(admReview.Spec.Name, v1.GetOptions{})
+	namespace, err := clientset.CoreV1().Namespaces().Get(review.Name, v1.GetOptions{})
 	if err != nil {
 		// If the namespace is not found, approve the request and let apiserver handle the case
 		// For any other error, reject the request
 		if apiErrors.IsNotFound(err) {
-			log.Debugf("Namespace %s not found, let apiserver handle the error: %s", admReview.Spec.Name, err.Error())
-			writeResponse(rw, &admReview, true, "")
+			review.logger().WithError(err).Debug("Namespace not found, let apiserver handle the error")
+			review.reason = reasonNotFound
+			writeResponse(rw, review, true, "")
 		} else {
-			errorMsg := fmt.Sprintf("Error occurred while retrieving the namespace %s: %s", admReview.Spec.Name, err.Error())
-			writeResponse(rw, &admReview, false, errorMsg)
+			errorMsg := fmt.Sprintf("Error occurred while retrieving the namespace %s: %s", review.Name, err.Error())
+			recordNamespaceEvent(review, nil, corev1.EventTypeWarning, eventDeletionRejected,
+				"Deletion requested by user %s rejected: %s", review.UserInfo.Username, errorMsg)
+			review.reason = reasonError
+			writeResponse(rw, review, false, errorMsg)
 		}
 		return
 	}
 
-	if annotations := namespace.GetAnnotations(); annotations != nil {
-		if annotations[bypassAnnotationKey] == "true" {
-			log.Infof("Namespace %s has the bypass annotation set[%s:true]. OK to DELETE.", admReview.Spec.Name, bypassAnnotationKey)
-			writeResponse(rw, &admReview, true, "")
+	if reason, protected := currentPolicy().Protected.match(review.Name, namespace.GetLabels()); protected {
+		data := newMessageData(review.Name, review.UserInfo.Username, review.UserInfo.Groups)
+		data.Reason = reason
+		errorMsg := currentPolicy().Messages.protectedMessage(data)
+		recordNamespaceEvent(review, namespace, corev1.EventTypeWarning, eventDeletionRejected,
+			"Deletion requested by user %s rejected: %s", review.UserInfo.Username, errorMsg)
+		review.reason = reasonProtected
+		review.rule = reason
+		writeResponse(rw, review, false, errorMsg)
+		return
+	}
+
+	if *admitAll == true {
+		admitWithoutValidation(rw, review, namespace)
+		return
+	}
+
+	if entry, allowed := currentPolicy().Allowlist.match(review.UserInfo); allowed {
+		review.logger().WithField("allowlisted", entry).Info("DELETE allowed by identity. OK to DELETE without validation.")
+		review.reason = reasonAllowlisted
+		review.rule = entry
+		writeResponse(rw, review, true, "")
+		return
+	}
+
+	// the risk checks with their own bypass annotation still apply to bypassed deletions
+	var riskErr error
+	bypassed, requested, bypassErr := parseBypass(namespace.GetAnnotations(), time.Now(), currentPolicy().Bypass.RequireExpiry)
+	if requested && bypassErr == nil {
+		timeout := validationTimeout(req, start)
+		var timedOut []string
+		timedOut, riskErr = validateBypassedDeletion(review.Name, namespace.GetAnnotations(), timeout)
+		if riskErr == nil && len(timedOut) > 0 {
+			warnTimedOut(review, timedOut, timeout)
+		}
+	}
+	if requested {
+		if bypassErr == nil && riskErr == nil {
+			review.logger().WithFields(logrus.Fields{
+				"annotation":   bypassAnnotationKey,
+				"bypass":       bypassed.String(),
+				"bypassReason": bypassed.reason,
+			}).Info("Namespace has the bypass annotation set. OK to DELETE.")
+			recordNamespaceEvent(review, namespace, corev1.EventTypeNormal, eventDeletionBypassed,
+				"Deletion requested by user %s allowed by the bypass annotation %s, it %s, with reason: %s",
+				review.UserInfo.Username, bypassAnnotationKey, bypassed, bypassed.reason)
+			review.reason = reasonBypass
+			review.rule = fmt.Sprintf("%s, it %s, with reason: %s", bypassAnnotationKey, bypassed, bypassed.reason)
+			writeResponse(rw, review, true, "")
 			return
 		}
+		if bypassErr != nil {
+			review.logger().WithError(bypassErr).Warn("Ignoring the bypass annotation")
+		} else {
+			review.logger().WithField("annotation", bypassAnnotationKey).Info("Namespace has the bypass annotation set, which does not cover the resources found by the risk checks.")
+		}
 	}
 
-	err = validateNamespaceDeletion(admReview.Spec.Name)
+	mode := namespaceMode(review.Name, namespace.GetLabels())
+	if mode == modeOff {
+		review.logger().WithField("mode", modeOff).Info("OK to DELETE without validation.")
+		review.reason = reasonModeOff
+		review.rule = fmt.Sprintf("mode %s", mode)
+		writeResponse(rw, review, true, "")
+		return
+	}
+
+	timeout := validationTimeout(req, start)
+	var timedOut []string
+	if riskErr != nil {
+		err = riskErr
+	} else {
+		var warnings []string
+		review.counts, timedOut, warnings, err = validateNamespaceDeletion(review.Name, namespace.GetAnnotations(), timeout)
+		for _, warning := range warnings {
+			review.logger().Warn(warning)
+		}
+		review.warnings = append(review.warnings, warnings...)
+	}
 	if err != nil {
-		writeResponse(rw, &admReview, false, err.Error())
+		reason, rule := reasonError, ""
+		if vErr, ok := err.(*validationError); ok {
+			vErr.data.User = review.UserInfo.Username
+			vErr.data.Groups = review.UserInfo.Groups
+			review.causes = vErr.causes
+			reason = vErr.reason
+			rule = vErr.rule
+		}
+		errorMsg := err.Error()
+		if bypassErr != nil {
+			errorMsg += fmt.Sprintf(" The bypass annotation is not honored because %s.", bypassErr.Error())
+		}
+		if mode == modeWarn {
+			review.logger().WithFields(logrus.Fields{
+				"mode":    modeWarn,
+				"message": errorMsg,
+			}).Warn("Allowing the DELETE that would have been rejected")
+			review.warnings = append(review.warnings, fmt.Sprintf("k8s-namespace-guard would have rejected this deletion: %s", errorMsg))
+			review.reason = reasonWarned
+			review.rule = fmt.Sprintf("mode %s", mode)
+			writeResponse(rw, review, true, "")
+			return
+		}
+		recordNamespaceEvent(review, namespace, corev1.EventTypeWarning, eventDeletionRejected,
+			"Deletion requested by user %s rejected: %s", review.UserInfo.Username, errorMsg)
+		review.reason = reason
+		review.rule = rule
+		writeResponse(rw, review, false, errorMsg)
+		return
+	}
+
+	if len(timedOut) > 0 {
+		warnTimedOut(review, timedOut, timeout)
+		review.reason = reasonTimeout
+		writeResponse(rw, review, true, "")
 		return
 	}
 
-	log.Infof("Namespace %s does not contain any workload resources. OK to DELETE.", admReview.Spec.Name)
-	writeResponse(rw, &admReview, true, "")
+	review.logger().Info("Namespace does not contain any workload resources. OK to DELETE.")
+	review.reason = reasonEmpty
+	writeResponse(rw, review, true, "")
 }
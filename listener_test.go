@@ -10,19 +10,23 @@ import (
 	"io/ioutil"
 	"net/http"
 	"net/http/httptest"
+	"os"
 	"os/user"
 	"testing"
+	"time"
 
-	"k8s.io/api/admission/v1alpha1"
+	admissionv1beta1 "k8s.io/api/admission/v1beta1"
+	appsv1 "k8s.io/api/apps/v1"
 	authenticationv1 "k8s.io/api/authentication/v1"
+	autoscalingv1 "k8s.io/api/autoscaling/v1"
+	corev1 "k8s.io/api/core/v1"
+	extensionsv1beta1 "k8s.io/api/extensions/v1beta1"
 	"k8s.io/apimachinery/pkg/apis/meta/v1"
 	"k8s.io/apimachinery/pkg/runtime"
+	"k8s.io/apimachinery/pkg/runtime/schema"
+	"k8s.io/apimachinery/pkg/types"
 	"k8s.io/client-go/kubernetes/fake"
-	"k8s.io/client-go/pkg/api"
-	corev1 "k8s.io/client-go/pkg/api/v1"
-	appsv1beta1 "k8s.io/client-go/pkg/apis/apps/v1beta1"
-	autoscalingv1 "k8s.io/client-go/pkg/apis/autoscaling/v1"
-	extensionsv1beta1 "k8s.io/client-go/pkg/apis/extensions/v1beta1"
+	clienttesting "k8s.io/client-go/testing"
 
 	"github.com/stretchr/testify/assert"
 )
@@ -37,8 +41,8 @@ var (
 			Finalizers: []corev1.FinalizerName{"kubernetes"},
 		},
 	}
-	templateAdmReview = &v1alpha1.AdmissionReview{
-		Spec: v1alpha1.AdmissionReviewSpec{
+	templateAdmReview = &legacyAdmissionReview{
+		Spec: legacyAdmissionReviewSpec{
 			Resource: v1.GroupVersionResource{
 				Group:    "",
 				Version:  "v1",
@@ -67,25 +71,34 @@ var (
 )
 
 func cloneNamespace(templateNamespace *corev1.Namespace) *corev1.Namespace {
-	testNamespaceObj, err := api.Scheme.DeepCopy(templateNamespace)
-	testNamespace, ok := testNamespaceObj.(*corev1.Namespace)
-	if err != nil || !ok {
-		panic(fmt.Sprintf("Cloning Namespace failed with err: %v, ok: %t", err, ok))
-	}
-	return testNamespace
+	return templateNamespace.DeepCopy()
 }
 
-func cloneAdmissionReview(templateAdmReview *v1alpha1.AdmissionReview) *v1alpha1.AdmissionReview {
-	testAdmReviewObj, err := api.Scheme.DeepCopy(templateAdmReview)
-	testAdmReview, ok := testAdmReviewObj.(*v1alpha1.AdmissionReview)
-	if err != nil || !ok {
-		panic(fmt.Sprintf("Cloning test AdmissionReview spec failed with err: %v, ok: %t", err, ok))
+// cloneAdmissionReview copies the review through its json encoding, the v1alpha1 types declared in review.go
+// have no generated deep copy.
+func cloneAdmissionReview(templateAdmReview *legacyAdmissionReview) *legacyAdmissionReview {
+	data, err := json.Marshal(templateAdmReview)
+	testAdmReview := &legacyAdmissionReview{}
+	if err == nil {
+		err = json.Unmarshal(data, testAdmReview)
+	}
+	if err != nil {
+		panic(fmt.Sprintf("Cloning test AdmissionReview spec failed with err: %v", err))
 	}
 	return testAdmReview
 }
 
-func getAdmissionReview(rw *httptest.ResponseRecorder) *v1alpha1.AdmissionReview {
-	admReview := &v1alpha1.AdmissionReview{}
+func getAdmissionReview(rw *httptest.ResponseRecorder) *legacyAdmissionReview {
+	admReview := &legacyAdmissionReview{}
+	err := json.NewDecoder(rw.Result().Body).Decode(admReview)
+	if err != nil {
+		panic(err.Error())
+	}
+	return admReview
+}
+
+func getV1AdmissionReview(rw *httptest.ResponseRecorder) *admissionReview {
+	admReview := &admissionReview{}
 	err := json.NewDecoder(rw.Result().Body).Decode(admReview)
 	if err != nil {
 		panic(err.Error())
@@ -93,7 +106,31 @@ func getAdmissionReview(rw *httptest.ResponseRecorder) *v1alpha1.AdmissionReview
 	return admReview
 }
 
-func constructPostBody(admReview *v1alpha1.AdmissionReview) io.Reader {
+func constructV1PostBody(apiVersion string, legacy *legacyAdmissionReview) io.Reader {
+	admReview := &admissionReview{
+		TypeMeta: v1.TypeMeta{
+			APIVersion: apiVersion,
+			Kind:       "AdmissionReview",
+		},
+		Request: &admissionRequest{
+			UID:       types.UID("b0a1a7a2-3c5d-4d1e-9f0a-6c7e8d9f0a1b"),
+			Kind:      legacy.Spec.Kind,
+			Resource:  legacy.Spec.Resource,
+			Name:      legacy.Spec.Name,
+			Namespace: legacy.Spec.Namespace,
+			Operation: legacy.Spec.Operation,
+			UserInfo:  legacy.Spec.UserInfo,
+		},
+	}
+	body := new(bytes.Buffer)
+	err := json.NewEncoder(body).Encode(admReview)
+	if err != nil {
+		panic(err.Error())
+	}
+	return body
+}
+
+func constructPostBody(admReview *legacyAdmissionReview) io.Reader {
 	body := new(bytes.Buffer)
 	err := json.NewEncoder(body).Encode(admReview)
 	if err != nil {
@@ -104,13 +141,13 @@ func constructPostBody(admReview *v1alpha1.AdmissionReview) io.Reader {
 
 func TestAllowedWriteResponse(t *testing.T) {
 	rw := httptest.NewRecorder()
-	review := &v1alpha1.AdmissionReview{}
+	review := &reviewRequest{}
 	writeResponse(rw, review, true, "")
 
 	admReview := getAdmissionReview(rw)
 
-	expectedAdmReview := &v1alpha1.AdmissionReview{
-		Status: v1alpha1.AdmissionReviewStatus{
+	expectedAdmReview := &legacyAdmissionReview{
+		Status: legacyAdmissionReviewStatus{
 			Allowed: true,
 			Result: &v1.Status{
 				Reason: v1.StatusReason(""),
@@ -125,13 +162,13 @@ func TestAllowedWriteResponse(t *testing.T) {
 
 func TestNotAllowedWriteResponse(t *testing.T) {
 	rw := httptest.NewRecorder()
-	review := &v1alpha1.AdmissionReview{}
+	review := &reviewRequest{}
 	writeResponse(rw, review, false, "Namespace test-namespace contains one or more resources")
 
 	admReview := getAdmissionReview(rw)
 
-	expectedAdmReview := &v1alpha1.AdmissionReview{
-		Status: v1alpha1.AdmissionReviewStatus{
+	expectedAdmReview := &legacyAdmissionReview{
+		Status: legacyAdmissionReviewStatus{
 			Allowed: false,
 			Result: &v1.Status{
 				Reason: v1.StatusReason("Namespace test-namespace contains one or more resources"),
@@ -144,6 +181,32 @@ func TestNotAllowedWriteResponse(t *testing.T) {
 		"writeResponse should write Allowed: false for AdmissionReviewStatus")
 }
 
+func TestV1WriteResponse(t *testing.T) {
+	rw := httptest.NewRecorder()
+	review := &reviewRequest{
+		apiVersion:       admissionV1,
+		admissionRequest: admissionRequest{UID: types.UID("test-uid")},
+	}
+	writeResponse(rw, review, false, "Namespace test-namespace contains one or more resources")
+
+	admReview := getV1AdmissionReview(rw)
+
+	assert.Equal(t, admissionV1, admReview.APIVersion, "writeResponse should reply in the apiVersion of the request")
+	assert.Equal(t, "AdmissionReview", admReview.Kind)
+	assert.Equal(t,
+		&admissionResponse{
+			UID:     types.UID("test-uid"),
+			Allowed: false,
+			Result: &v1.Status{
+				Message: "Namespace test-namespace contains one or more resources",
+				Reason:  v1.StatusReasonForbidden,
+				Code:    403,
+			},
+		},
+		admReview.Response,
+		"writeResponse should echo the request uid in the response stanza")
+}
+
 func TestWrongMethodWebhookHandler(t *testing.T) {
 	rw := httptest.NewRecorder()
 	req := httptest.NewRequest("GET", "http://localhost:8080/namespaces", nil)
@@ -177,12 +240,32 @@ func TestWrongReqBodyWebhookHandler(t *testing.T) {
 	assert.Contains(t, admReview.Status.Result.Reason, "Failed to decode the request body json into an AdmissionReview resource: ")
 }
 
+func TestUnsupportedAPIVersionWebhookHandler(t *testing.T) {
+	rw := httptest.NewRecorder()
+	req := httptest.NewRequest("POST", "http://localhost:8080/", bytes.NewBufferString(`{"apiVersion":"admission.k8s.io/v2","kind":"AdmissionReview"}`))
+
+	webhookHandler(rw, req)
+
+	admReview := getAdmissionReview(rw)
+
+	assert.False(t, admReview.Status.Allowed, "should fail if the AdmissionReview apiVersion is not supported")
+	assert.Contains(t, admReview.Status.Result.Reason, `unsupported AdmissionReview apiVersion "admission.k8s.io/v2"`)
+}
+
 func TestAdmitAllWebhookHandler(t *testing.T) {
 	rw := httptest.NewRecorder()
 
 	testSpec := cloneAdmissionReview(templateAdmReview)
 
 	*admitAll = true
+	defer func() { *admitAll = false }()
+	testPod := &corev1.Pod{
+		ObjectMeta: v1.ObjectMeta{
+			Name:      "test-pod",
+			Namespace: "test-namespace",
+		},
+	}
+	clientset = fake.NewSimpleClientset(testPod, cloneNamespace(templateNamespace))
 
 	req := httptest.NewRequest("POST", "http://localhost:8080/", constructPostBody(testSpec))
 	webhookHandler(rw, req)
@@ -190,14 +273,32 @@ func TestAdmitAllWebhookHandler(t *testing.T) {
 	admReview := getAdmissionReview(rw)
 
 	assert.True(t, admReview.Status.Allowed, "should allow namespace delete to pass through if admitAll flag is set")
-	*admitAll = false
+}
+
+func TestAdmitAllProtectedWebhookHandler(t *testing.T) {
+	*admitAll = true
+	defer func() { *admitAll = false }()
+	testNamespace := cloneNamespace(templateNamespace)
+	testNamespace.Name = "kube-system"
+	clientset = fake.NewSimpleClientset(testNamespace)
+
+	testSpec := cloneAdmissionReview(templateAdmReview)
+	testSpec.Spec.Name = "kube-system"
+	testSpec.Spec.Namespace = "kube-system"
+	rw := httptest.NewRecorder()
+	req := httptest.NewRequest("POST", "http://localhost:8080/", constructPostBody(testSpec))
+	webhookHandler(rw, req)
+
+	admReview := getAdmissionReview(rw)
+	assert.False(t, admReview.Status.Allowed, "should reject the deletion of a protected namespace even if admitAll flag is set")
+	assert.Contains(t, admReview.Status.Result.Reason, "The namespace kube-system is protected and can never be deleted")
 }
 
 func TestNamespaceResourceTypeWebhookHandler(t *testing.T) {
 	rw := httptest.NewRecorder()
 
-	testSpec := &v1alpha1.AdmissionReview{
-		Spec: v1alpha1.AdmissionReviewSpec{
+	testSpec := &legacyAdmissionReview{
+		Spec: legacyAdmissionReviewSpec{
 			Resource: v1.GroupVersionResource{
 				Group:    "",
 				Version:  "v1",
@@ -220,15 +321,15 @@ func TestWrongOperationWebhookHandler(t *testing.T) {
 
 	testSpec := cloneAdmissionReview(templateAdmReview)
 
-	testSpec.Spec.Operation = v1alpha1.Create
+	testSpec.Spec.Operation = admissionv1beta1.Connect
 
 	req := httptest.NewRequest("POST", "http://localhost:8080/", constructPostBody(testSpec))
 	webhookHandler(rw, req)
 
 	admReview := getAdmissionReview(rw)
 
-	assert.False(t, admReview.Status.Allowed, "should reject if the operation is NOT DELETE")
-	assert.Contains(t, admReview.Status.Result.Reason, "Incoming operation is CREATE on namespace test-namespace. Only DELETE is currently supported.")
+	assert.False(t, admReview.Status.Allowed, "should reject if the operation is neither CREATE, UPDATE nor DELETE")
+	assert.Contains(t, admReview.Status.Result.Reason, "Incoming operation is CONNECT on namespace test-namespace. Only CREATE, UPDATE and DELETE are currently supported.")
 }
 
 func TestNonExistingNamespaceWebhookHandler(t *testing.T) {
@@ -257,7 +358,7 @@ func TestBypassAnnotationTrueWebhookHandler(t *testing.T) {
 		},
 	}
 	testNamespace := cloneNamespace(templateNamespace)
-	testNamespace.Annotations = map[string]string{bypassAnnotationKey: "true"}
+	testNamespace.Annotations = map[string]string{bypassAnnotationKey: "true", bypassReasonAnnotationKey: "decommissioning test-namespace"}
 	clientset = fake.NewSimpleClientset(testPod, testNamespace)
 
 	testSpec := cloneAdmissionReview(templateAdmReview)
@@ -356,39 +457,39 @@ func TestNonEmptyNamespaceWithMoreResourcesWebhookHandler(t *testing.T) {
 			ExternalName: "test-svc.yahoo.com",
 		},
 	}
-	testReplicaSet := &extensionsv1beta1.ReplicaSet{
+	testReplicaSet := &appsv1.ReplicaSet{
 		ObjectMeta: v1.ObjectMeta{
 			Name:      "test-replicaset",
 			Namespace: "test-namespace",
 		},
-		Spec: extensionsv1beta1.ReplicaSetSpec{
+		Spec: appsv1.ReplicaSetSpec{
 			Replicas: new(int32),
 		},
 	}
-	testDeployment := &appsv1beta1.Deployment{
+	testDeployment := &appsv1.Deployment{
 		ObjectMeta: v1.ObjectMeta{
 			Name:      "test-deploy",
 			Namespace: "test-namespace",
 		},
-		Spec: appsv1beta1.DeploymentSpec{
+		Spec: appsv1.DeploymentSpec{
 			Replicas: new(int32),
 		},
 	}
-	testStatefulSet := &appsv1beta1.StatefulSet{
+	testStatefulSet := &appsv1.StatefulSet{
 		ObjectMeta: v1.ObjectMeta{
 			Name:      "test-statefulset",
 			Namespace: "test-namespace",
 		},
-		Spec: appsv1beta1.StatefulSetSpec{
+		Spec: appsv1.StatefulSetSpec{
 			Replicas: new(int32),
 		},
 	}
-	testDaemonSet := &extensionsv1beta1.DaemonSet{
+	testDaemonSet := &appsv1.DaemonSet{
 		ObjectMeta: v1.ObjectMeta{
 			Name:      "test-daemonset",
 			Namespace: "test-namespace",
 		},
-		Spec: extensionsv1beta1.DaemonSetSpec{
+		Spec: appsv1.DaemonSetSpec{
 			RevisionHistoryLimit: new(int32),
 		},
 	}
@@ -460,9 +561,265 @@ func TestNonEmptyNamespaceWithIgnoredResourcesWebhookHandler(t *testing.T) {
 	assert.True(t, admReview.Status.Allowed, "should approve if the namespace has ignored resources")
 }
 
+func TestV1NonEmptyNamespaceWebhookHandler(t *testing.T) {
+	for _, apiVersion := range []string{admissionV1beta1, admissionV1} {
+		rw := httptest.NewRecorder()
+
+		testPod := &corev1.Pod{
+			ObjectMeta: v1.ObjectMeta{
+				Name:      "test-pod",
+				Namespace: "test-namespace",
+			},
+		}
+		testNamespace := cloneNamespace(templateNamespace)
+		clientset = fake.NewSimpleClientset(testPod, testNamespace)
+		req := httptest.NewRequest("POST", "http://localhost:8080/", constructV1PostBody(apiVersion, templateAdmReview))
+		webhookHandler(rw, req)
+
+		admReview := getV1AdmissionReview(rw)
+
+		assert.Equal(t, apiVersion, admReview.APIVersion, "should reply in the apiVersion of the request")
+		assert.Equal(t, types.UID("b0a1a7a2-3c5d-4d1e-9f0a-6c7e8d9f0a1b"), admReview.Response.UID, "should echo the request uid")
+		assert.False(t, admReview.Response.Allowed, "should reject if the namespace has pod resources")
+		assert.Contains(t, admReview.Response.Result.Message, "The namespace test-namespace you are trying to remove contains one or more of these resources: [pods(1)].")
+		assert.Equal(t, v1.StatusReasonForbidden, admReview.Response.Result.Reason, "should not put the message in the reason")
+		assert.Equal(t, int32(403), admReview.Response.Result.Code)
+		assert.Equal(t, &v1.StatusDetails{
+			Name:   "test-namespace",
+			Kind:   "namespaces",
+			Causes: []v1.StatusCause{{Type: causeTypeBlockingResources, Field: "pods", Message: "1 pods: test-pod"}},
+		}, admReview.Response.Result.Details, "should list one cause per blocking kind")
+	}
+}
+
+func TestStaticCountersServedAPIs(t *testing.T) {
+	// the group/versions Kubernetes 1.16 stopped serving for the resources of the built-in list
+	removed := []schema.GroupVersionResource{
+		{Group: "extensions", Version: "v1beta1", Resource: "daemonsets"},
+		{Group: "extensions", Version: "v1beta1", Resource: "deployments"},
+		{Group: "extensions", Version: "v1beta1", Resource: "replicasets"},
+		{Group: "apps", Version: "v1beta1", Resource: "deployments"},
+		{Group: "apps", Version: "v1beta1", Resource: "statefulsets"},
+		{Group: "apps", Version: "v1beta2", Resource: "daemonsets"},
+		{Group: "apps", Version: "v1beta2", Resource: "deployments"},
+		{Group: "apps", Version: "v1beta2", Resource: "replicasets"},
+		{Group: "apps", Version: "v1beta2", Resource: "statefulsets"},
+	}
+	for _, c := range staticCounters {
+		for _, gvr := range removed {
+			assert.NotEqual(t, gvr, c.gvr, "%s should not be listed through an API removed in Kubernetes 1.16", c.kind)
+		}
+	}
+}
+
+func TestFormatNames(t *testing.T) {
+	var objects []v1.Object
+	for _, name := range []string{"web-3", "web-1", "web-2"} {
+		objects = append(objects, &corev1.Pod{ObjectMeta: v1.ObjectMeta{Name: name}})
+	}
+	assert.Equal(t, "web-1, web-2, web-3", formatNames(objects, 3, 3))
+	assert.Equal(t, "web-1 and 2 more", formatNames(objects, 3, 1))
+	assert.Equal(t, "web-1, web-2, web-3 and 7 more", formatNames(objects, 10, 3), "should count the objects of the pages that were not listed")
+}
+
+func TestObjectNamesWebhookHandler(t *testing.T) {
+	defer func(max int) { *maxObjectNames = max }(*maxObjectNames)
+	*maxObjectNames = 2
+
+	testNamespace := cloneNamespace(templateNamespace)
+	objects := []runtime.Object{testNamespace}
+	for _, name := range []string{"web-1", "web-2", "web-3"} {
+		objects = append(objects, &corev1.Pod{ObjectMeta: v1.ObjectMeta{Name: name, Namespace: "test-namespace"}})
+	}
+	objects = append(objects, &corev1.Service{ObjectMeta: v1.ObjectMeta{Name: "web", Namespace: "test-namespace"}})
+	clientset = fake.NewSimpleClientset(objects...)
+
+	rw := httptest.NewRecorder()
+	req := httptest.NewRequest("POST", "http://localhost:8080/", constructPostBody(cloneAdmissionReview(templateAdmReview)))
+	webhookHandler(rw, req)
+
+	admReview := getAdmissionReview(rw)
+	assert.False(t, admReview.Status.Allowed, "should reject if the namespace has workload resources")
+	assert.Contains(t, admReview.Status.Result.Reason, "Please delete them and try again. Remaining pods: web-1, web-2 and 1 more; services: web.")
+	if assert.NotNil(t, admReview.Status.Result.Details, "should return the status details") {
+		assert.Equal(t, []v1.StatusCause{
+			{Type: causeTypeBlockingResources, Field: "pods", Message: "3 pods: web-1, web-2 and 1 more"},
+			{Type: causeTypeBlockingResources, Field: "services", Message: "1 services: web"},
+		}, admReview.Status.Result.Details.Causes)
+	}
+}
+
+func TestV1EmptyNamespaceWebhookHandler(t *testing.T) {
+	for _, apiVersion := range []string{admissionV1beta1, admissionV1} {
+		rw := httptest.NewRecorder()
+
+		testNamespace := cloneNamespace(templateNamespace)
+		clientset = fake.NewSimpleClientset(testNamespace)
+		req := httptest.NewRequest("POST", "http://localhost:8080/", constructV1PostBody(apiVersion, templateAdmReview))
+		webhookHandler(rw, req)
+
+		admReview := getV1AdmissionReview(rw)
+
+		assert.Equal(t, apiVersion, admReview.APIVersion, "should reply in the apiVersion of the request")
+		assert.True(t, admReview.Response.Allowed, "should approve if the namespace has no workload resources")
+	}
+}
+
 func TestStatusHandler200(t *testing.T) {
 	rw := httptest.NewRecorder()
 	req := httptest.NewRequest("GET", "http://localhost:8080/status.html", nil)
 	statusHandler(rw, req)
 	assert.Equal(t, http.StatusOK, rw.Code, "/status.html should return 200")
 }
+
+// slowClientset answers the lists of resource after delay. The fake clientset answers one request at a
+// time, so every list is delayed behind a slow one.
+func slowClientset(resource string, delay time.Duration, objects ...runtime.Object) *fake.Clientset {
+	fakeClientset := fake.NewSimpleClientset(objects...)
+	fakeClientset.PrependReactor("list", resource, func(action clienttesting.Action) (bool, runtime.Object, error) {
+		time.Sleep(delay)
+		return false, nil, nil
+	})
+	return fakeClientset
+}
+
+// countPodsOnly makes the pods the only resources counted until the returned function is called
+func countPodsOnly(t *testing.T) func() {
+	filename := writePolicyFile("resources:\n- resource: pods\n")
+	defer os.Remove(filename)
+	testPolicy, err := loadPolicy(filename, false)
+	assert.Nil(t, err, "Error should be nil")
+	previousPolicy, volumes, addresses := currentPolicy(), *protectVolumes, *protectAddrs
+	activePolicy.Store(testPolicy)
+	*protectVolumes, *protectAddrs = false, false
+	return func() {
+		activePolicy.Store(previousPolicy)
+		*protectVolumes, *protectAddrs = volumes, addresses
+	}
+}
+
+func TestListAll(t *testing.T) {
+	release := make(chan struct{})
+	defer close(release)
+	counters := []resourceCounter{
+		{kind: "fast", counter: func(namespace string) ([]v1.Object, error) {
+			return []v1.Object{&corev1.Pod{ObjectMeta: v1.ObjectMeta{Name: "test-pod"}}}, nil
+		}},
+		{kind: "slow", counter: func(namespace string) ([]v1.Object, error) {
+			<-release
+			return nil, nil
+		}},
+	}
+
+	results, timedOut := listAll(counters, "test-namespace", 50*time.Millisecond)
+	assert.Equal(t, []string{"slow"}, timedOut)
+	if assert.NotNil(t, results[0], "the fast list should have finished") {
+		assert.Len(t, results[0].objects, 1)
+	}
+	assert.Nil(t, results[1], "the slow list should not have finished")
+
+	results, timedOut = listAll(counters[:1], "test-namespace", 0)
+	assert.Empty(t, timedOut)
+	assert.NotNil(t, results[0])
+}
+
+func TestValidationTimeout(t *testing.T) {
+	defer func(timeout time.Duration) { *countTimeout = timeout }(*countTimeout)
+	*countTimeout = 8 * time.Second
+
+	start := time.Now()
+	timeout := validationTimeout(httptest.NewRequest("POST", "http://localhost:8080/?timeout=5s", nil), start)
+	assert.True(t, timeout > 4*time.Second && timeout <= 4500*time.Millisecond, "should keep a tenth of the apiserver timeout, got %s", timeout)
+
+	timeout = validationTimeout(httptest.NewRequest("POST", "http://localhost:8080/?timeout=30s", nil), start)
+	assert.True(t, timeout > 7*time.Second && timeout <= 8*time.Second, "should not exceed --countTimeout, got %s", timeout)
+
+	timeout = validationTimeout(httptest.NewRequest("POST", "http://localhost:8080/", nil), start.Add(-time.Minute))
+	assert.Equal(t, time.Millisecond, timeout, "should leave a minimal timeout once the deadline passed")
+
+	*countTimeout = 0
+	assert.Equal(t, time.Duration(0), validationTimeout(httptest.NewRequest("POST", "http://localhost:8080/", nil), start))
+}
+
+func TestTimeoutRejectWebhookHandler(t *testing.T) {
+	defer countPodsOnly(t)()
+	clientset = slowClientset("pods", 500*time.Millisecond, cloneNamespace(templateNamespace))
+	rejected := metricValue(admissionDecisions.WithLabelValues("rejected", reasonTimeout, "DELETE"))
+
+	rw := httptest.NewRecorder()
+	req := httptest.NewRequest("POST", "http://localhost:8080/?timeout=100ms", constructPostBody(cloneAdmissionReview(templateAdmReview)))
+	webhookHandler(rw, req)
+
+	admReview := getAdmissionReview(rw)
+	assert.False(t, admReview.Status.Allowed, "should reject if the resources could not be counted in time")
+	assert.Contains(t, admReview.Status.Result.Reason, "listing [pods]")
+	assert.Equal(t, rejected+1, metricValue(admissionDecisions.WithLabelValues("rejected", reasonTimeout, "DELETE")),
+		"should record the rejection as a timeout")
+}
+
+func TestTimeoutAllowWebhookHandler(t *testing.T) {
+	defer countPodsOnly(t)()
+	defer func(value string) { *onTimeout = value }(*onTimeout)
+	*onTimeout = onTimeoutAllow
+	clientset = slowClientset("pods", 500*time.Millisecond, cloneNamespace(templateNamespace))
+
+	rw := httptest.NewRecorder()
+	req := httptest.NewRequest("POST", "http://localhost:8080/?timeout=100ms", constructV1PostBody(admissionV1, templateAdmReview))
+	webhookHandler(rw, req)
+
+	admReview := getV1AdmissionReview(rw)
+	assert.True(t, admReview.Response.Allowed, "should allow if the resources could not be counted in time and onTimeout is allow")
+	if assert.Len(t, admReview.Response.Warnings, 1) {
+		assert.Contains(t, admReview.Response.Warnings[0], "could not check [pods]")
+	}
+}
+
+func TestListErrorWebhookHandler(t *testing.T) {
+	defer countPodsOnly(t)()
+	fakeClientset := fake.NewSimpleClientset(cloneNamespace(templateNamespace))
+	fakeClientset.PrependReactor("list", "pods", func(action clienttesting.Action) (bool, runtime.Object, error) {
+		return true, nil, fmt.Errorf("connection refused")
+	})
+	clientset = fakeClientset
+	rejected := metricValue(admissionDecisions.WithLabelValues("rejected", reasonError, "DELETE"))
+
+	rw := httptest.NewRecorder()
+	req := httptest.NewRequest("POST", "http://localhost:8080/", constructPostBody(cloneAdmissionReview(templateAdmReview)))
+	webhookHandler(rw, req)
+
+	admReview := getAdmissionReview(rw)
+	assert.False(t, admReview.Status.Allowed, "should reject if the resources could not be listed")
+	assert.Contains(t, admReview.Status.Result.Reason, "error listing pods, connection refused")
+	assert.Equal(t, rejected+1, metricValue(admissionDecisions.WithLabelValues("rejected", reasonError, "DELETE")),
+		"should record the rejection as an error")
+}
+
+func TestBypassedTimeoutWebhookHandler(t *testing.T) {
+	defer func(value string) { *onTimeout = value }(*onTimeout)
+	testNamespace := cloneNamespace(templateNamespace)
+	testNamespace.Annotations = map[string]string{bypassAnnotationKey: "true", bypassReasonAnnotationKey: "decommissioning"}
+	newClientset := func() {
+		clientset = slowClientset("services", 500*time.Millisecond, testNamespace)
+	}
+
+	newClientset()
+	rw := httptest.NewRecorder()
+	req := httptest.NewRequest("POST", "http://localhost:8080/?timeout=100ms", constructPostBody(cloneAdmissionReview(templateAdmReview)))
+	webhookHandler(rw, req)
+
+	admReview := getAdmissionReview(rw)
+	assert.False(t, admReview.Status.Allowed, "should reject a bypassed deletion if the address check could not run in time")
+	assert.Contains(t, admReview.Status.Result.Reason, "timed out")
+
+	*onTimeout = onTimeoutAllow
+	newClientset()
+	rw = httptest.NewRecorder()
+	req = httptest.NewRequest("POST", "http://localhost:8080/?timeout=100ms", constructV1PostBody(admissionV1, templateAdmReview))
+	webhookHandler(rw, req)
+
+	v1Review := getV1AdmissionReview(rw)
+	assert.True(t, v1Review.Response.Allowed, "should allow a bypassed deletion if the address check could not run in time and onTimeout is allow")
+	if assert.Len(t, v1Review.Response.Warnings, 1) {
+		assert.Contains(t, v1Review.Response.Warnings[0], "could not check [external-address-services]")
+	}
+}
@@ -4,14 +4,22 @@ package main
 
 import (
 	"bytes"
+	"fmt"
 	"github.com/Sirupsen/logrus"
 	"io"
 	"os"
+	"sort"
 	"strings"
 
 	"gopkg.in/natefinch/lumberjack.v2"
 )
 
+const (
+	logFormatText = "text"
+	logFormatJSON = "json"
+)
+
+// Formatter writes `LEVEL [time] message` followed by the fields of the entry as sorted key=value pairs
 type Formatter struct {
 }
 
@@ -20,23 +28,54 @@ func (f *Formatter) Format(entry *logrus.Entry) ([]byte, error) {
 	s := strings.ToUpper(entry.Level.String()) + " [" + entry.Time.Format("2006-01-02 15:04:05") + "] " + entry.Message
 
 	b.WriteString(s)
+
+	keys := make([]string, 0, len(entry.Data))
+	for key := range entry.Data {
+		keys = append(keys, key)
+	}
+	sort.Strings(keys)
+	for _, key := range keys {
+		fmt.Fprintf(b, " %s=%v", key, entry.Data[key])
+	}
 	b.WriteByte('\n')
 	return b.Bytes(), nil
 }
 
-func createLogger(writer io.Writer, level string) *logrus.Logger {
+// newFormatter returns the formatter for the --logFormat value
+func newFormatter(format string) (logrus.Formatter, error) {
+	switch format {
+	case logFormatText:
+		return new(Formatter), nil
+	case logFormatJSON:
+		return &logrus.JSONFormatter{}, nil
+	}
+	return nil, fmt.Errorf("unknown log format %q, expected %s or %s", format, logFormatText, logFormatJSON)
+}
+
+// logger returns the entry logging with the fields identifying the review
+func (r *reviewRequest) logger() *logrus.Entry {
+	return log.WithFields(logrus.Fields{
+		"uid":       r.UID,
+		"namespace": r.Name,
+		"operation": r.Operation,
+		"user":      r.UserInfo.Username,
+		"groups":    r.UserInfo.Groups,
+	})
+}
+
+func createLogger(writer io.Writer, level string, formatter logrus.Formatter) *logrus.Logger {
 	logLevel, _ := logrus.ParseLevel(level)
 
 	myLogger := &logrus.Logger{
 		Out:       writer,
-		Formatter: new(Formatter),
+		Formatter: formatter,
 		Level:     logLevel,
 	}
 	return myLogger
 
 }
 
-func getLogger(logFilename string, level string) *logrus.Logger {
+func getLogger(logFilename string, level string, formatter logrus.Formatter) *logrus.Logger {
 	fileWriter := io.MultiWriter(os.Stdout, &lumberjack.Logger{
 		Filename:   logFilename,
 		MaxSize:    1, // Mb
@@ -44,6 +83,6 @@ func getLogger(logFilename string, level string) *logrus.Logger {
 		MaxAge:     28, // Days
 	})
 
-	myLogger := createLogger(fileWriter, level)
+	myLogger := createLogger(fileWriter, level, formatter)
 	return myLogger
 }
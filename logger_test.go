@@ -4,19 +4,84 @@ package main
 
 import (
 	"bytes"
+	"encoding/json"
 	"io"
+	"net/http/httptest"
 	"testing"
 
+	"github.com/Sirupsen/logrus"
 	"github.com/stretchr/testify/assert"
+	"k8s.io/client-go/kubernetes/fake"
 )
 
 func TestLogger(t *testing.T) {
 	var buf1 bytes.Buffer
 	writer := io.MultiWriter(&buf1)
-	testLogger := createLogger(writer, "info")
+	testLogger := createLogger(writer, "info", new(Formatter))
 
 	testLogger.Info("test")
 	testLogger.Warn("test")
 
 	assert.Regexp(t, "INFO .* test\nWARNING .* test", buf1.String())
 }
+
+func TestTextLoggerFields(t *testing.T) {
+	var buf bytes.Buffer
+	testLogger := createLogger(&buf, "info", new(Formatter))
+
+	testLogger.WithFields(logrus.Fields{"user": "jane", "namespace": "test-namespace"}).Info("test")
+
+	assert.Regexp(t, "INFO .* test namespace=test-namespace user=jane\n", buf.String())
+}
+
+func TestJSONLogger(t *testing.T) {
+	var buf bytes.Buffer
+	formatter, err := newFormatter("json")
+	assert.Nil(t, err, "Error should be nil")
+	testLogger := createLogger(&buf, "info", formatter)
+
+	testLogger.WithFields(logrus.Fields{"user": "jane", "groups": []string{"developers"}}).Info("test")
+
+	entry := map[string]interface{}{}
+	assert.Nil(t, json.Unmarshal(buf.Bytes(), &entry), "should write one JSON document per entry")
+	assert.Equal(t, "test", entry["msg"])
+	assert.Equal(t, "info", entry["level"])
+	assert.Equal(t, "jane", entry["user"])
+	assert.Equal(t, []interface{}{"developers"}, entry["groups"])
+}
+
+func TestInvalidLogFormat(t *testing.T) {
+	_, err := newFormatter("xml")
+	assert.NotNil(t, err, "should reject an unknown log format")
+}
+
+func TestBypassLogFields(t *testing.T) {
+	var buf bytes.Buffer
+	formatter, err := newFormatter("json")
+	assert.Nil(t, err, "Error should be nil")
+	defer func(logger *logrus.Logger) { log = logger }(log)
+	log = createLogger(&buf, "info", formatter)
+
+	testNamespace := cloneNamespace(templateNamespace)
+	testNamespace.Annotations = map[string]string{bypassAnnotationKey: "true", bypassReasonAnnotationKey: "decommissioning"}
+	clientset = fake.NewSimpleClientset(testNamespace)
+
+	rw := httptest.NewRecorder()
+	req := httptest.NewRequest("POST", "http://localhost:8080/", constructPostBody(cloneAdmissionReview(templateAdmReview)))
+	webhookHandler(rw, req)
+
+	var bypassEntry map[string]interface{}
+	decoder := json.NewDecoder(&buf)
+	for decoder.More() {
+		entry := map[string]interface{}{}
+		assert.Nil(t, decoder.Decode(&entry), "should write one JSON document per entry")
+		if entry["msg"] == "Namespace has the bypass annotation set. OK to DELETE." {
+			bypassEntry = entry
+		}
+	}
+	if assert.NotNil(t, bypassEntry, "should log the honored bypass") {
+		assert.Equal(t, bypassAnnotationKey, bypassEntry["annotation"])
+		assert.Equal(t, "decommissioning", bypassEntry["bypassReason"])
+		assert.Equal(t, "test-namespace", bypassEntry["namespace"])
+	}
+}
@@ -3,40 +3,107 @@
 package main
 
 import (
-	"crypto/tls"
-	"crypto/x509"
 	"flag"
 	"io"
 	"net/http"
-
-	"io/ioutil"
 	"os"
 	"os/signal"
 	"syscall"
+	"time"
 
 	"github.com/Sirupsen/logrus"
+	"github.com/prometheus/client_golang/prometheus/promhttp"
+	"k8s.io/apimachinery/pkg/runtime/schema"
+	"k8s.io/client-go/dynamic"
+	"k8s.io/client-go/dynamic/dynamicinformer"
+	"k8s.io/client-go/informers"
 	"k8s.io/client-go/kubernetes"
+	"k8s.io/client-go/metadata"
 	"k8s.io/client-go/rest"
 )
 
 var (
-	port          = flag.String("port", "443", "Server port.")
-	logFilename   = flag.String("logFile", "/var/log/nslifecycle.log", "Log file name and full path.")
-	logLevel      = flag.String("logLevel", "info", "The log level.")
-	httpsCertFile = flag.String("certFile", "/var/lib/kubernetes/kubernetes.pem", "The cert file for the https server.")
-	httpsKeyFile  = flag.String("keyFile", "/var/lib/kubernetes/kubernetes-key.pem", "The key file for the https server.")
-	clientCAFile  = flag.String("clientCAFile", "/var/run/secrets/kubernetes.io/serviceaccount/ca.crt", "The cluster root CA that signs the apiserver cert")
-	clientAuth    = flag.Bool("clientAuth", false, "True to verify client cert/auth during TLS handshake.")
-	admitAll      = flag.Bool("admitAll", false, "True to admit all namespace deletions without validation.")
-
-	clientset kubernetes.Interface
+	port           = flag.String("port", "443", "Server port.")
+	logFilename    = flag.String("logFile", "/var/log/nslifecycle.log", "Log file name and full path.")
+	logLevel       = flag.String("logLevel", "info", "The log level.")
+	logFormat      = flag.String("logFormat", logFormatText, "The log format: text or json.")
+	httpsCertFile  = flag.String("certFile", "/var/lib/kubernetes/kubernetes.pem", "The cert file for the https server.")
+	httpsKeyFile   = flag.String("keyFile", "/var/lib/kubernetes/kubernetes-key.pem", "The key file for the https server.")
+	clientCAFile   = flag.String("clientCAFile", "/var/run/secrets/kubernetes.io/serviceaccount/ca.crt", "The cluster root CA that signs the apiserver cert")
+	clientAuth     = flag.Bool("clientAuth", false, "True to verify client cert/auth during TLS handshake.")
+	admitAll       = flag.Bool("admitAll", false, "True to admit all namespace deletions without validation.")
+	mode           = flag.String("mode", string(modeEnforce), "The default enforcement mode: enforce rejects deletions failing validation, warn allows them with an admission warning, off skips validation.")
+	discoveryMode  = flag.Bool("discovery", false, "True to check every listable namespaced resource type found through the discovery API, including CRDs, instead of the built-in list.")
+	includeRes     = flag.String("includeResources", "", "Comma separated group/resources to check, e.g. pods,apps/deployments,argoproj.io/*. Empty checks the built-in list, or every discovered resource type in discovery mode.")
+	excludeRes     = flag.String("excludeResources", defaultExcludedResources, "Comma separated group/resources to ignore.")
+	cacheEnabled   = flag.Bool("cache", false, "True to count resources from shared informer caches instead of listing them on every request.")
+	cacheResync    = flag.Duration("cacheResync", 5*time.Minute, "The resync period of the informer caches.")
+	cacheMaxStale  = flag.Duration("cacheMaxStaleness", 15*time.Minute, "The time after which an informer cache that has not observed any change is considered stale and a live List is used instead. Resyncs do not count as changes.")
+	cacheSyncWait  = flag.Duration("cacheSyncTimeout", time.Minute, "The time to wait for the informer caches to sync at startup, after which /ready.html reports ready and the resource types that have not synced are listed live.")
+	reloadInterval = flag.Duration("reloadInterval", time.Minute, "How often the cert, key, client CA and policy files are checked for changes. 0 disables reloading.")
+	policyFile     = flag.String("policyFile", "", "The YAML or JSON file listing the resource types that block a namespace deletion. Overrides --includeResources and --excludeResources.")
+	auditLogFile   = flag.String("auditLogFile", "", "The file receiving one JSON record per admission decision. Empty disables the audit log.")
+	auditMaxSize   = flag.Int("auditLogMaxSize", 100, "The size in megabytes at which the audit log is rotated.")
+	auditBackups   = flag.Int("auditLogMaxBackups", 10, "The number of rotated audit logs to keep. 0 keeps all of them.")
+	auditMaxAge    = flag.Int("auditLogMaxAge", 90, "The number of days to keep rotated audit logs. 0 keeps them regardless of their age.")
+	auditFsync     = flag.Bool("auditLogFsync", false, "True to flush every audit record to disk before answering the admission review.")
+	maxObjectNames = flag.Int("maxObjectNames", 5, "The number of object names listed per kind of resources blocking a deletion. 0 lists the counts only.")
+	countTimeout   = flag.Duration("countTimeout", 8*time.Second, "The time after which counting the resources of a namespace is given up on, shortened to fit the timeout the apiserver sends. 0 waits for the apiserver timeout.")
+	onTimeout      = flag.String("onTimeout", onTimeoutReject, "What happens to a deletion whose resources could not be counted in time: reject or allow.")
+	listWorkers    = flag.Int("listConcurrency", 10, "The number of resource types listed at once.")
+	protectVolumes = flag.Bool("protectVolumes", true, "True to block the deletion of namespaces holding persistentvolumeclaims bound to volumes with the reclaim policy Delete.")
+	protectAddrs   = flag.Bool("protectAddresses", true, "True to block the deletion of namespaces holding services of type LoadBalancer or with external IPs, unless the address bypass annotation is set.")
+	ownerRollUp    = flag.Bool("rollUpOwners", false, "True to report the topmost owners of the resources blocking a deletion, such as deployments, along with the number of resources they own, instead of every kind.")
+	metadataLists  = flag.Bool("metadataLists", true, "True to list the metadata of a single page of resources, counting the others from the remaining item count, instead of listing whole objects.")
+	bypassVerb     = flag.String("bypassVerb", "bypass", "The virtual verb on --bypassResource a user needs, as checked by a SubjectAccessReview, to add or change the bypass annotation. Empty lets anyone who may update the namespace set it.")
+	bypassRes      = flag.String("bypassResource", "namespaces/guard", "The namespace resource/subresource the --bypassVerb is checked on.")
+
+	clientset   kubernetes.Interface
+	objectCache *resourceCache
 
 	log *logrus.Logger
 )
 
 func init() {
 	flag.Parse()
-	log = getLogger(*logFilename, *logLevel)
+	formatter, err := newFormatter(*logFormat)
+	if err != nil {
+		log = getLogger(*logFilename, *logLevel, new(Formatter))
+		log.Fatalf("Invalid logFormat: %s", err.Error())
+	}
+	log = getLogger(*logFilename, *logLevel, formatter)
+
+	if *auditLogFile != "" {
+		auditLog = newAuditSink(*auditLogFile, *auditMaxSize, *auditBackups, *auditMaxAge, *auditFsync)
+	}
+
+	if *onTimeout != onTimeoutReject && *onTimeout != onTimeoutAllow {
+		log.Fatalf("Invalid onTimeout: %q, expected %s or %s", *onTimeout, onTimeoutReject, onTimeoutAllow)
+	}
+	if *listWorkers < 1 {
+		log.Fatalf("Invalid listConcurrency: %d, at least one list has to run at once", *listWorkers)
+	}
+
+	defaultMode, err = parseEnforcementMode(*mode)
+	if err != nil {
+		log.Fatalf("Invalid mode: %s", err.Error())
+	}
+
+	activeBypassPermission, err = parseBypassPermission(*bypassVerb, *bypassRes)
+	if err != nil {
+		log.Fatalf("Invalid bypass permission: %s", err.Error())
+	}
+
+	var p *policy
+	if *policyFile != "" {
+		p, err = loadPolicy(*policyFile, *discoveryMode)
+	} else {
+		p, err = newFlagPolicy(*includeRes, *excludeRes, *discoveryMode)
+	}
+	if err != nil {
+		log.Fatalf("Invalid policy: %s", err.Error())
+	}
+	activePolicy.Store(p)
 }
 
 // statusHandler serves the /status.html response which is always 200.
@@ -45,6 +112,15 @@ func statusHandler(rw http.ResponseWriter, req *http.Request) {
 	io.WriteString(rw, "OK")
 }
 
+// readinessHandler serves the /ready.html response which is 503 until the informer caches have synced.
+func readinessHandler(rw http.ResponseWriter, req *http.Request) {
+	if objectCache != nil && !objectCache.ready() {
+		http.Error(rw, "Informer caches are not synced yet", http.StatusServiceUnavailable)
+		return
+	}
+	io.WriteString(rw, "OK")
+}
+
 func main() {
 
 	// creates the k8s in-cluster config
@@ -53,41 +129,100 @@ func main() {
 		log.Fatalf("Error occurred while building the in-cluster kube-config: %s", err.Error())
 	}
 
+	// bounds every request of the clients below by --countTimeout, so that the lists abandoned by a count
+	// that timed out end as well instead of piling up
+	listConfig := rest.CopyConfig(config)
+	listConfig.Timeout = *countTimeout
+
 	// creates the clientset
-	clientset, err = kubernetes.NewForConfig(config)
+	clientset, err = kubernetes.NewForConfig(listConfig)
 	if err != nil {
 		log.Fatalf("Error occurred while initializing the client set: %s", err.Error())
 	}
 
+	// creates the metadata client used to tell whether a namespace holds resources without listing them all
+	if *metadataLists {
+		metadataClient, err = metadata.NewForConfig(listConfig)
+		if err != nil {
+			log.Fatalf("Error occurred while initializing the metadata client: %s", err.Error())
+		}
+	}
+
+	// records events on the namespaces whose deletion is rejected or bypassed
+	eventRecorder = newEventRecorder(clientset)
+
+	// creates the dynamic client used to count discovered resources and those outside the built-in list
+	dynamicClient, err = dynamic.NewForConfig(listConfig)
+	if err != nil {
+		log.Fatalf("Error occurred while initializing the dynamic client: %s", err.Error())
+	}
+
+	// start the informer caches in the background, /ready.html reports when they have synced
+	if *cacheEnabled {
+		// the watches of the informers outlast --countTimeout, they get clients of their own without it
+		cacheClientset, err := kubernetes.NewForConfig(config)
+		if err != nil {
+			log.Fatalf("Error occurred while initializing the informer client set: %s", err.Error())
+		}
+		cacheDynamic, err := dynamic.NewForConfig(config)
+		if err != nil {
+			log.Fatalf("Error occurred while initializing the informer dynamic client: %s", err.Error())
+		}
+		objectCache = newResourceCache(informers.NewSharedInformerFactory(cacheClientset, *cacheResync),
+			dynamicinformer.NewDynamicSharedInformerFactory(cacheDynamic, *cacheResync), *cacheMaxStale, make(chan struct{}))
+
+		go func() {
+			counters, err := checkedCounters()
+			if err != nil {
+				log.Errorf("Error occurred while listing the resource types to cache: %s", err.Error())
+			}
+			var gvrs []schema.GroupVersionResource
+			for _, c := range counters {
+				gvrs = append(gvrs, c.gvr)
+			}
+			if err := objectCache.warm(gvrs); err != nil {
+				log.Warnf("Error occurred while warming the informer caches: %s", err.Error())
+			}
+		}()
+	}
+
+	// refresh the bypass annotation gauge in the background rather than on every scrape
+	go watchBypassAnnotatedNamespaces(bypassGaugeInterval, make(chan struct{}))
+
 	// add the serving path handlers
 	mux := http.NewServeMux()
 	mux.HandleFunc("/status.html", statusHandler)
+	mux.HandleFunc("/ready.html", readinessHandler)
+	mux.Handle("/metrics", promhttp.Handler())
 	mux.HandleFunc("/", webhookHandler)
 
-	// load the https server cert and key
-	xcert, err := tls.LoadX509KeyPair(*httpsCertFile, *httpsKeyFile)
+	// load the https server cert and key, and the cluster CA that signs the client(apiserver) cert
+	reloader, err := newTLSReloader(*httpsCertFile, *httpsKeyFile, *clientCAFile, *clientAuth)
 	if err != nil {
-		log.Fatalf("Unable to read the server cert and/or key file: %s", err.Error())
+		log.Fatalf("Unable to load the TLS material: %s", err.Error())
 	}
 
-	// load the cluster CA that signs the client(apiserver) cert
-	caCert, err := ioutil.ReadFile(*clientCAFile)
-	if err != nil {
-		log.Fatalf("Couldn't load file: %s", err.Error())
-	}
-
-	caCertPool := x509.NewCertPool()
-	caCertPool.AppendCertsFromPEM(caCert)
+	// create the TLS config for the https server, the cert and CA pool are looked up on every handshake
+	tlsConfig := reloader.tlsConfig()
+	tlsConfig.GetConfigForClient = reloader.getConfigForClient
 
-	// create the TLS config for the https server
-	tlsConfig := &tls.Config{
-		RootCAs:      caCertPool,
-		Certificates: []tls.Certificate{xcert},
-		ClientCAs:    caCertPool,
-	}
-	// enable client(apiserver) certificate verification if --clientAuth=true
-	if *clientAuth {
-		tlsConfig.ClientAuth = tls.RequireAndVerifyClientCert
+	// reload the TLS material and the policy file when they change on disk
+	if *reloadInterval > 0 {
+		watchers := []*fileWatcher{
+			newFileWatcher("server certificate", reloader.loadCertificate, *httpsCertFile, *httpsKeyFile),
+			newFileWatcher("client CA", reloader.loadClientCA, *clientCAFile),
+		}
+		if *policyFile != "" {
+			watchers = append(watchers, newFileWatcher("policy", func() error {
+				p, err := loadPolicy(*policyFile, *discoveryMode)
+				if err != nil {
+					return err
+				}
+				activePolicy.Store(p)
+				return nil
+			}, *policyFile))
+		}
+		go watchFiles(*reloadInterval, make(chan struct{}), watchers...)
 	}
 
 	// create the https server object
@@ -0,0 +1,179 @@
+// Copyright 2017 Yahoo Holdings Inc. 
+// Licensed under the terms of the 3-Clause BSD License.
+package main
+
+import (
+	"bytes"
+	"fmt"
+	"strings"
+	"text/template"
+
+	"k8s.io/apimachinery/pkg/apis/meta/v1"
+)
+
+// default message templates, which the policy file may replace to point users to a runbook or ticketing process
+const (
+	defaultRejectionMessage = "The namespace {{.Namespace}} you are trying to remove contains one or more of these resources: {{.Resources}}. " +
+		"Please delete them and try again.{{if .Remaining}} Remaining {{.Remaining}}.{{end}}"
+	defaultErrorMessage  = "The following error(s) occurred while validating the DELETE operation on the namespace {{.Namespace}}: {{.Errors}}."
+	defaultBypassMessage = "WARNING: If you know what you are doing, run " +
+		"`kubectl annotate namespace {{.Namespace}} {{.AnnotationKey}}=<RFC3339 expiry> {{.ReasonAnnotationKey}}=\"<reason>\"` to bypass this policy check."
+	defaultProtectedMessage = "The namespace {{.Namespace}} is protected and can never be deleted: {{.Reason}}. " +
+		"The bypass annotation {{.AnnotationKey}} does not apply to protected namespaces."
+	defaultRiskMessage = "{{range .Risks}}The namespace {{$.Namespace}} {{.Description}}: " +
+		"{{range $i, $object := .Objects}}{{if $i}}, {{end}}{{$object}}{{end}}." +
+		"{{if .BypassAnnotationKey}} The bypass annotation does not apply to them, set {{.BypassAnnotationKey}}=<RFC3339 expiry> " +
+		"{{.BypassReasonAnnotationKey}}=\"<reason>\" to allow their deletion.{{end}} {{end}}"
+)
+
+// messageTemplates are the Go text/templates of the messages returned to the client, executed with messageData.
+type messageTemplates struct {
+	// Rejection is the message when resources block the deletion.
+	Rejection string `json:"rejection,omitempty"`
+	// Error is the message when the resources could not be listed.
+	Error string `json:"error,omitempty"`
+	// Bypass is appended to the rejection and error messages to tell how to bypass the check.
+	Bypass string `json:"bypass,omitempty"`
+	// Protected is the message when the namespace is protected.
+	Protected string `json:"protected,omitempty"`
+	// Risk is the message when resources whose deletion does damage beyond the namespace block the deletion.
+	Risk string `json:"risk,omitempty"`
+
+	rejection *template.Template
+	error     *template.Template
+	bypass    *template.Template
+	protected *template.Template
+	risk      *template.Template
+}
+
+// messageData is what the message templates have access to.
+type messageData struct {
+	Namespace string
+	User      string
+	Groups    []string
+	// Resources lists the blocking kinds with their counts, e.g. [pods(3) services(1)]
+	Resources []string
+	Blocking  []blockingKind
+	// Risks lists the resources found by the risk checks, e.g. claims whose volumes would be deleted
+	Risks []riskFinding
+	// Remaining lists the names of the blocking resources, e.g. "pods: web-1, web-2 and 1 more; services: web"
+	Remaining string
+	Errors    []string
+	// Reason explains why the namespace is protected
+	Reason string
+
+	AnnotationKey        string
+	ExpiresAnnotationKey string
+	ReasonAnnotationKey  string
+}
+
+// blockingKind are the resources of one kind blocking a deletion. Names holds up to --maxObjectNames
+// names, More the number of the others. With --rollUpOwners, Dependents counts the resources of every
+// kind owned by them, e.g. {"pods": 3, "replicasets": 1} for a deployment.
+type blockingKind struct {
+	Kind       string
+	Count      int
+	Names      []string
+	More       int
+	Dependents map[string]int
+
+	objects []v1.Object
+}
+
+// newMessageData returns the data common to every message about namespace requested by user
+func newMessageData(namespace, user string, groups []string) *messageData {
+	return &messageData{
+		Namespace:            namespace,
+		User:                 user,
+		Groups:               groups,
+		AnnotationKey:        bypassAnnotationKey,
+		ExpiresAnnotationKey: bypassExpiresAnnotationKey,
+		ReasonAnnotationKey:  bypassReasonAnnotationKey,
+	}
+}
+
+// sampleMessageData is used to check the templates when the policy is loaded
+var sampleMessageData = &messageData{
+	Namespace: "my-namespace",
+	User:      "jane",
+	Groups:    []string{"developers"},
+	Resources: []string{"pods(3)"},
+	Blocking:  []blockingKind{{Kind: "pods", Count: 3, Names: []string{"web-1", "web-2"}, More: 1}},
+	Remaining: "pods: web-1, web-2 and 1 more",
+	Errors:    []string{"error listing services, timeout"},
+	Reason:    "it is in the list of protected namespaces",
+	Risks: []riskFinding{{Kind: "reclaim-delete-volumes", Description: "holds persistentvolumeclaims bound to volumes with the reclaim policy Delete",
+		Objects: []string{"data-0 (10Gi)"}}},
+
+	AnnotationKey:        bypassAnnotationKey,
+	ExpiresAnnotationKey: bypassExpiresAnnotationKey,
+	ReasonAnnotationKey:  bypassReasonAnnotationKey,
+}
+
+// validate parses the templates, falling back to the defaults, and executes them once with sample data
+// so that references to unknown fields are reported when the policy is loaded.
+func (m *messageTemplates) validate() error {
+	for _, t := range []struct {
+		name     string
+		text     string
+		fallback string
+		compiled **template.Template
+	}{
+		{"rejection", m.Rejection, defaultRejectionMessage, &m.rejection},
+		{"error", m.Error, defaultErrorMessage, &m.error},
+		{"bypass", m.Bypass, defaultBypassMessage, &m.bypass},
+		{"protected", m.Protected, defaultProtectedMessage, &m.protected},
+		{"risk", m.Risk, defaultRiskMessage, &m.risk},
+	} {
+		text := t.text
+		if text == "" {
+			text = t.fallback
+		}
+		compiled, err := template.New(t.name).Parse(text)
+		if err != nil {
+			return fmt.Errorf("%s: %v", t.name, err)
+		}
+		if err := compiled.Execute(&bytes.Buffer{}, sampleMessageData); err != nil {
+			return fmt.Errorf("%s: %v", t.name, err)
+		}
+		*t.compiled = compiled
+	}
+	return nil
+}
+
+// render executes the template with data. A template failing on unexpected data is logged and
+// replaced by the default template, so that the client always gets a message.
+func render(t *template.Template, fallback string, data *messageData) string {
+	buf := &bytes.Buffer{}
+	if t != nil {
+		err := t.Execute(buf, data)
+		if err == nil {
+			return strings.TrimSpace(buf.String())
+		}
+		log.WithField("template", t.Name()).WithError(err).Error("Error executing the message template, using the default message")
+		buf.Reset()
+	}
+	template.Must(template.New("default").Parse(fallback)).Execute(buf, data)
+	return strings.TrimSpace(buf.String())
+}
+
+// rejectionMessage returns the message of a deletion blocked by resources or failing validation
+func (m *messageTemplates) rejectionMessage(data *messageData) string {
+	var parts []string
+	if len(data.Resources) > 0 {
+		parts = append(parts, render(m.rejection, defaultRejectionMessage, data))
+	}
+	if len(data.Risks) > 0 {
+		parts = append(parts, render(m.risk, defaultRiskMessage, data))
+	}
+	if len(data.Errors) > 0 {
+		parts = append(parts, render(m.error, defaultErrorMessage, data))
+	}
+	parts = append(parts, render(m.bypass, defaultBypassMessage, data))
+	return strings.Join(parts, " ")
+}
+
+// protectedMessage returns the message of a deletion of a protected namespace
+func (m *messageTemplates) protectedMessage(data *messageData) string {
+	return render(m.protected, defaultProtectedMessage, data)
+}
@@ -0,0 +1,95 @@
+// Copyright 2017 Yahoo Holdings Inc. 
+// Licensed under the terms of the 3-Clause BSD License.
+package main
+
+import (
+	"net/http/httptest"
+	"os"
+	"testing"
+
+	corev1 "k8s.io/api/core/v1"
+	"k8s.io/apimachinery/pkg/apis/meta/v1"
+	"k8s.io/client-go/kubernetes/fake"
+
+	"github.com/stretchr/testify/assert"
+)
+
+const testMessagesPolicyYAML = `
+messages:
+  rejection: "{{.User}}, {{.Namespace}} still holds {{range $i, $b := .Blocking}}{{if $i}}, {{end}}{{$b.Count}} {{$b.Kind}}{{end}}."
+  bypass: "See https://runbook.example.com/namespaces#{{.Namespace}} before setting {{.AnnotationKey}}."
+  protected: "{{.Namespace}} is protected ({{.Reason}}), file a ticket at https://tickets.example.com."
+`
+
+func TestDefaultMessages(t *testing.T) {
+	messages := messageTemplates{}
+	assert.Nil(t, messages.validate(), "Error should be nil")
+
+	data := newMessageData("test-namespace", "jane", nil)
+	data.Resources = []string{"pods(1)"}
+	data.Errors = []string{"error listing services, timeout"}
+	assert.Equal(t, "The namespace test-namespace you are trying to remove contains one or more of these resources: [pods(1)]. Please delete them and try again. "+
+		"The following error(s) occurred while validating the DELETE operation on the namespace test-namespace: [error listing services, timeout]. "+
+		"WARNING: If you know what you are doing, run `kubectl annotate namespace test-namespace "+bypassAnnotationKey+"=<RFC3339 expiry> "+bypassReasonAnnotationKey+"=\"<reason>\"` to bypass this policy check.",
+		messages.rejectionMessage(data))
+}
+
+func TestInvalidMessages(t *testing.T) {
+	invalidPolicies := []struct {
+		content  string
+		errorMsg string
+	}{
+		{"messages:\n  rejection: \"{{.Namespace\"\n", "messages: rejection: "},
+		{"messages:\n  protected: \"{{.Ticket}}\"\n", "messages: protected: "},
+	}
+
+	for _, invalidPolicy := range invalidPolicies {
+		filename := writePolicyFile(invalidPolicy.content)
+		_, err := loadPolicy(filename, false)
+		os.Remove(filename)
+
+		assert.NotNil(t, err, "should reject the policy %q", invalidPolicy.content)
+		if err != nil {
+			assert.Contains(t, err.Error(), invalidPolicy.errorMsg)
+		}
+	}
+}
+
+func TestCustomMessagesWebhookHandler(t *testing.T) {
+	filename := writePolicyFile(testMessagesPolicyYAML)
+	defer os.Remove(filename)
+	testPolicy, err := loadPolicy(filename, false)
+	assert.Nil(t, err, "Error should be nil")
+	defer activePolicy.Store(currentPolicy())
+	activePolicy.Store(testPolicy)
+
+	testPod := &corev1.Pod{
+		ObjectMeta: v1.ObjectMeta{
+			Name:      "test-pod",
+			Namespace: "test-namespace",
+		},
+	}
+	clientset = fake.NewSimpleClientset(testPod, cloneNamespace(templateNamespace))
+
+	testSpec := cloneAdmissionReview(templateAdmReview)
+	rw := httptest.NewRecorder()
+	req := httptest.NewRequest("POST", "http://localhost:8080/", constructPostBody(testSpec))
+	webhookHandler(rw, req)
+
+	admReview := getAdmissionReview(rw)
+	assert.False(t, admReview.Status.Allowed, "should reject if the namespace has pod resources")
+	assert.Equal(t, testSpec.Spec.UserInfo.Username+", test-namespace still holds 1 pods. "+
+		"See https://runbook.example.com/namespaces#test-namespace before setting "+bypassAnnotationKey+".", string(admReview.Status.Result.Reason))
+
+	testNamespace := cloneNamespace(templateNamespace)
+	testNamespace.Name = "kube-system"
+	clientset = fake.NewSimpleClientset(testNamespace)
+	testSpec.Spec.Name = "kube-system"
+	rw = httptest.NewRecorder()
+	req = httptest.NewRequest("POST", "http://localhost:8080/", constructPostBody(testSpec))
+	webhookHandler(rw, req)
+
+	admReview = getAdmissionReview(rw)
+	assert.False(t, admReview.Status.Allowed, "should reject the deletion of a protected namespace")
+	assert.Equal(t, "kube-system is protected (it is in the list of protected namespaces), file a ticket at https://tickets.example.com.", string(admReview.Status.Result.Reason))
+}
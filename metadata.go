@@ -0,0 +1,43 @@
+// Copyright 2017 Yahoo Holdings Inc. 
+// Licensed under the terms of the 3-Clause BSD License.
+package main
+
+import (
+	"k8s.io/apimachinery/pkg/apis/meta/v1"
+	"k8s.io/apimachinery/pkg/runtime/schema"
+	"k8s.io/client-go/metadata"
+)
+
+// metadataClient lists PartialObjectMetadata, nil when --metadataLists is disabled
+var metadataClient metadata.Interface
+
+// metadataPageSize is the number of resources listed by listMetadata: one to tell whether there are any,
+// or as many as the names shown in the rejection message.
+func metadataPageSize() int64 {
+	if *maxObjectNames > 1 {
+		return int64(*maxObjectNames)
+	}
+	return 1
+}
+
+// listMetadata lists the metadata of the first limit gvr resources in namespace, or of all of them if limit is 0.
+// count adds the number of resources remaining after the page when the apiserver reports it, and complete is
+// false when it does not, in which case the caller has to list every resource to count them.
+func listMetadata(gvr schema.GroupVersionResource, namespace string, limit int64) (objects []v1.Object, count int, complete bool, err error) {
+	list, err := metadataClient.Resource(gvr).Namespace(namespace).List(v1.ListOptions{Limit: limit})
+	if err != nil {
+		return nil, 0, false, err
+	}
+	objects = make([]v1.Object, len(list.Items))
+	for i := range list.Items {
+		objects[i] = &list.Items[i]
+	}
+	count = len(objects)
+	if list.Continue == "" {
+		return objects, count, true, nil
+	}
+	if list.RemainingItemCount != nil {
+		return objects, count + int(*list.RemainingItemCount), true, nil
+	}
+	return objects, count, false, nil
+}
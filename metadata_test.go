@@ -0,0 +1,123 @@
+// Copyright 2017 Yahoo Holdings Inc. 
+// Licensed under the terms of the 3-Clause BSD License.
+package main
+
+import (
+	"net/http/httptest"
+	"testing"
+
+	corev1 "k8s.io/api/core/v1"
+	"k8s.io/apimachinery/pkg/apis/meta/v1"
+	"k8s.io/apimachinery/pkg/runtime"
+	"k8s.io/apimachinery/pkg/runtime/schema"
+	"k8s.io/client-go/kubernetes/fake"
+	metadatafake "k8s.io/client-go/metadata/fake"
+	clienttesting "k8s.io/client-go/testing"
+
+	"github.com/stretchr/testify/assert"
+)
+
+// pagedMetadataClient answers the pod lists with a single page holding names, followed by remaining
+// pods if remaining is not nil, and every other list with an empty page. The fake client expects the
+// reactors to answer with a v1.List of PartialObjectMetadata.
+func pagedMetadataClient(names []string, remaining *int64) *metadatafake.FakeMetadataClient {
+	client := metadatafake.NewSimpleMetadataClient(metadatafake.NewTestScheme())
+	client.PrependReactor("list", "*", func(action clienttesting.Action) (bool, runtime.Object, error) {
+		list := &v1.List{}
+		if action.GetResource().Resource != "pods" {
+			return true, list, nil
+		}
+		for _, name := range names {
+			list.Items = append(list.Items, runtime.RawExtension{Object: &v1.PartialObjectMetadata{
+				ObjectMeta: v1.ObjectMeta{Name: name, Namespace: action.GetNamespace()},
+			}})
+		}
+		if remaining != nil {
+			list.Continue = "next-page"
+			list.RemainingItemCount = remaining
+		}
+		return true, list, nil
+	})
+	return client
+}
+
+func TestListMetadata(t *testing.T) {
+	defer func() { metadataClient = nil }()
+	pods := schema.GroupVersionResource{Group: "", Version: "v1", Resource: "pods"}
+
+	remaining := int64(4)
+	metadataClient = pagedMetadataClient([]string{"web-1"}, &remaining)
+	objects, count, complete, err := listMetadata(pods, "test-namespace", 1)
+	assert.Nil(t, err, "Error should be nil")
+	assert.True(t, complete, "should count the remaining pods")
+	assert.Equal(t, 5, count)
+	assert.Len(t, objects, 1)
+
+	metadataClient = pagedMetadataClient([]string{"web-1", "web-2"}, nil)
+	_, count, complete, err = listMetadata(pods, "test-namespace", 2)
+	assert.Nil(t, err, "Error should be nil")
+	assert.True(t, complete, "a page without continue token holds every pod")
+	assert.Equal(t, 2, count)
+}
+
+func TestIncompleteMetadataList(t *testing.T) {
+	defer func() { metadataClient = nil }()
+	metadataClient = metadatafake.NewSimpleMetadataClient(metadatafake.NewTestScheme())
+	metadataClient.(*metadatafake.FakeMetadataClient).PrependReactor("list", "pods", func(action clienttesting.Action) (bool, runtime.Object, error) {
+		return true, &v1.List{
+			ListMeta: v1.ListMeta{Continue: "next-page"},
+			Items:    []runtime.RawExtension{{Object: &v1.PartialObjectMetadata{ObjectMeta: v1.ObjectMeta{Name: "pod-1"}}}},
+		}, nil
+	})
+	var pods []runtime.Object
+	for _, name := range []string{"pod-1", "pod-2", "pod-3"} {
+		pods = append(pods, &corev1.Pod{ObjectMeta: v1.ObjectMeta{Name: name, Namespace: "test-namespace"}})
+	}
+	clientset = fake.NewSimpleClientset(pods...)
+
+	c, _ := staticCounterFor(schema.GroupResource{Resource: "pods"})
+	objects, count, err := c.list("test-namespace")
+	assert.Nil(t, err, "Error should be nil")
+	assert.Equal(t, 3, count, "should list every pod if the apiserver does not report the remaining count")
+	assert.Len(t, objects, 3)
+}
+
+func TestEmptyMetadataPage(t *testing.T) {
+	defer func() { metadataClient = nil }()
+	remaining := int64(2)
+	metadataClient = pagedMetadataClient(nil, &remaining)
+	clientset = fake.NewSimpleClientset(
+		&corev1.Pod{ObjectMeta: v1.ObjectMeta{Name: "pod-1", Namespace: "test-namespace"}},
+		&corev1.Pod{ObjectMeta: v1.ObjectMeta{Name: "pod-2", Namespace: "test-namespace"}},
+	)
+
+	c, _ := staticCounterFor(schema.GroupResource{Resource: "pods"})
+	objects, count, err := c.list("test-namespace")
+	assert.Nil(t, err, "Error should be nil")
+	assert.Equal(t, 2, count, "should list every pod if the first page is empty")
+	assert.Len(t, objects, 2)
+}
+
+func TestMetadataListWebhookHandler(t *testing.T) {
+	defer func() { metadataClient = nil }()
+	defer func(max int) { *maxObjectNames = max }(*maxObjectNames)
+	*maxObjectNames = 2
+	// counting pods in every phase does not require listing whole pods
+	defer activePolicy.Store(currentPolicy())
+	testPolicy := &policy{Counting: countingPolicy{CountTerminating: true, CountedPodPhases: podPhases}}
+	assert.Nil(t, testPolicy.validate(false), "Error should be nil")
+	activePolicy.Store(testPolicy)
+
+	remaining := int64(998)
+	metadataClient = pagedMetadataClient([]string{"web-1", "web-2"}, &remaining)
+	clientset = fake.NewSimpleClientset(cloneNamespace(templateNamespace))
+
+	rw := httptest.NewRecorder()
+	req := httptest.NewRequest("POST", "http://localhost:8080/", constructPostBody(cloneAdmissionReview(templateAdmReview)))
+	webhookHandler(rw, req)
+
+	admReview := getAdmissionReview(rw)
+	assert.False(t, admReview.Status.Allowed, "should reject if the metadata list finds pods")
+	assert.Contains(t, admReview.Status.Result.Reason, "[pods(1000)]")
+	assert.Contains(t, admReview.Status.Result.Reason, "pods: web-1, web-2 and 998 more")
+}
@@ -0,0 +1,142 @@
+// Copyright 2017 Yahoo Holdings Inc. 
+// Licensed under the terms of the 3-Clause BSD License.
+package main
+
+import (
+	"math"
+	"time"
+
+	"github.com/prometheus/client_golang/prometheus"
+	"k8s.io/apimachinery/pkg/apis/meta/v1"
+	"k8s.io/apimachinery/pkg/runtime/schema"
+)
+
+// reasons recorded with every admission decision
+const (
+	reasonInvalidRequest = "invalid_request"
+	reasonAdmitAll       = "admit_all"
+	reasonCreate         = "create"
+	reasonUpdate         = "update"
+	reasonBypassDenied   = "bypass_permission_denied"
+	reasonNotFound       = "not_found"
+	reasonError          = "error"
+	reasonProtected      = "protected"
+	reasonAllowlisted    = "allowlisted"
+	reasonBypass         = "bypass"
+	reasonModeOff        = "mode_off"
+	reasonWarned         = "warned"
+	reasonNotEmpty       = "not_empty"
+	reasonDataLoss       = "data_loss"
+	reasonAddressRelease = "address_release"
+	reasonEmpty          = "empty"
+	reasonTimeout        = "timeout"
+)
+
+// bypassGaugeInterval is how often the bypass annotation gauge is refreshed
+const bypassGaugeInterval = time.Minute
+
+var (
+	admissionDecisions = prometheus.NewCounterVec(prometheus.CounterOpts{
+		Namespace: "k8s_namespace_guard",
+		Name:      "admission_decisions_total",
+		Help:      "Admission decisions by outcome, the reason that decided them and operation.",
+	}, []string{"outcome", "reason", "operation"})
+
+	webhookDuration = prometheus.NewHistogram(prometheus.HistogramOpts{
+		Namespace: "k8s_namespace_guard",
+		Name:      "webhook_duration_seconds",
+		Help:      "Time taken to answer an admission review.",
+		Buckets:   []float64{.005, .01, .025, .05, .1, .25, .5, 1, 2.5, 5, 10, 30},
+	})
+
+	listDuration = prometheus.NewHistogramVec(prometheus.HistogramOpts{
+		Namespace: "k8s_namespace_guard",
+		Name:      "list_duration_seconds",
+		Help:      "Time taken to list a resource type from the apiserver while validating a namespace deletion.",
+		Buckets:   []float64{.005, .01, .025, .05, .1, .25, .5, 1, 2.5, 5, 10},
+	}, []string{"resource"})
+
+	listErrors = prometheus.NewCounterVec(prometheus.CounterOpts{
+		Namespace: "k8s_namespace_guard",
+		Name:      "list_errors_total",
+		Help:      "Failed lists of a resource type while validating a namespace deletion.",
+	}, []string{"resource"})
+
+	bypassAnnotatedNamespaces = prometheus.NewGauge(prometheus.GaugeOpts{
+		Namespace: "k8s_namespace_guard",
+		Name:      "bypass_annotated_namespaces",
+		Help:      "Namespaces currently carrying the bypass annotation, whether it is honored or not.",
+	})
+
+	namespacesResource = schema.GroupVersionResource{Group: "", Version: "v1", Resource: "namespaces"}
+)
+
+func init() {
+	prometheus.MustRegister(admissionDecisions, webhookDuration, listDuration, listErrors, bypassAnnotatedNamespaces)
+}
+
+// recordDecision counts the verdict of the review along with the reason that decided it
+func recordDecision(review *reviewRequest, allowed bool) {
+	outcome := "rejected"
+	if allowed {
+		outcome = "allowed"
+	}
+	admissionDecisions.WithLabelValues(outcome, review.reason, string(review.Operation)).Inc()
+}
+
+// observeWebhookDuration records the time since start, to be deferred at the start of the handler
+func observeWebhookDuration(start time.Time) {
+	webhookDuration.Observe(time.Since(start).Seconds())
+}
+
+// observeList records the latency and the outcome of a live List of resource
+func observeList(resource string, start time.Time, err error) {
+	listDuration.WithLabelValues(resource).Observe(time.Since(start).Seconds())
+	if err != nil {
+		listErrors.WithLabelValues(resource).Inc()
+	}
+}
+
+// refreshBypassAnnotatedNamespaces sets the bypass annotation gauge from the namespaces in the informer cache
+// when it is enabled and fresh, and from a live List otherwise. The gauge is NaN if the namespaces cannot be listed.
+func refreshBypassAnnotatedNamespaces() {
+	var namespaces []v1.Object
+	ok := false
+	if objectCache != nil {
+		namespaces, ok = objectCache.objects(namespacesResource, v1.NamespaceAll)
+	}
+	if !ok {
+		list, err := clientset.CoreV1().Namespaces().List(v1.ListOptions{})
+		if err != nil {
+			log.WithError(err).Error("Error occurred while listing the namespaces for the bypass annotation gauge")
+			bypassAnnotatedNamespaces.Set(math.NaN())
+			return
+		}
+		namespaces = make([]v1.Object, len(list.Items))
+		for i := range list.Items {
+			namespaces[i] = &list.Items[i]
+		}
+	}
+	num := 0
+	for _, namespace := range namespaces {
+		if _, requested, _ := parseBypass(namespace.GetAnnotations(), time.Now(), false); requested {
+			num++
+		}
+	}
+	bypassAnnotatedNamespaces.Set(float64(num))
+}
+
+// watchBypassAnnotatedNamespaces refreshes the bypass annotation gauge every interval until stopCh is closed,
+// as there is no event telling when the annotation is removed again without watching every namespace.
+func watchBypassAnnotatedNamespaces(interval time.Duration, stopCh <-chan struct{}) {
+	ticker := time.NewTicker(interval)
+	defer ticker.Stop()
+	for {
+		refreshBypassAnnotatedNamespaces()
+		select {
+		case <-ticker.C:
+		case <-stopCh:
+			return
+		}
+	}
+}
@@ -0,0 +1,95 @@
+// Copyright 2017 Yahoo Holdings Inc. 
+// Licensed under the terms of the 3-Clause BSD License.
+package main
+
+import (
+	"errors"
+	"net/http/httptest"
+	"testing"
+	"time"
+
+	"github.com/prometheus/client_golang/prometheus"
+	dto "github.com/prometheus/client_model/go"
+	corev1 "k8s.io/api/core/v1"
+	"k8s.io/apimachinery/pkg/apis/meta/v1"
+	"k8s.io/apimachinery/pkg/runtime/schema"
+	"k8s.io/client-go/informers"
+	"k8s.io/client-go/kubernetes/fake"
+
+	"github.com/stretchr/testify/assert"
+)
+
+func metricValue(collector prometheus.Collector) float64 {
+	ch := make(chan prometheus.Metric, 1)
+	collector.Collect(ch)
+	metric := &dto.Metric{}
+	if err := (<-ch).Write(metric); err != nil {
+		panic(err.Error())
+	}
+	switch {
+	case metric.Counter != nil:
+		return metric.Counter.GetValue()
+	case metric.Gauge != nil:
+		return metric.Gauge.GetValue()
+	case metric.Histogram != nil:
+		return float64(metric.Histogram.GetSampleCount())
+	}
+	return 0
+}
+
+func TestRecordDecisionWebhookHandler(t *testing.T) {
+	testPod := &corev1.Pod{
+		ObjectMeta: v1.ObjectMeta{
+			Name:      "test-pod",
+			Namespace: "test-namespace",
+		},
+	}
+	clientset = fake.NewSimpleClientset(testPod, cloneNamespace(templateNamespace))
+
+	rejected := metricValue(admissionDecisions.WithLabelValues("rejected", reasonNotEmpty, "DELETE"))
+	handled := metricValue(webhookDuration)
+
+	rw := httptest.NewRecorder()
+	req := httptest.NewRequest("POST", "http://localhost:8080/", constructPostBody(cloneAdmissionReview(templateAdmReview)))
+	webhookHandler(rw, req)
+
+	assert.False(t, getAdmissionReview(rw).Status.Allowed, "should reject if the namespace has pod resources")
+	assert.Equal(t, rejected+1, metricValue(admissionDecisions.WithLabelValues("rejected", reasonNotEmpty, "DELETE")))
+	assert.Equal(t, handled+1, metricValue(webhookDuration))
+}
+
+func TestObserveList(t *testing.T) {
+	lists := metricValue(listDuration.WithLabelValues("test-resources"))
+	failures := metricValue(listErrors.WithLabelValues("test-resources"))
+
+	observeList("test-resources", time.Now(), nil)
+	observeList("test-resources", time.Now(), errors.New("connection refused"))
+
+	assert.Equal(t, lists+2, metricValue(listDuration.WithLabelValues("test-resources")))
+	assert.Equal(t, failures+1, metricValue(listErrors.WithLabelValues("test-resources")))
+}
+
+func TestBypassAnnotatedNamespaces(t *testing.T) {
+	annotated := cloneNamespace(templateNamespace)
+	annotated.Annotations = map[string]string{bypassAnnotationKey: "true"}
+	disabled := cloneNamespace(templateNamespace)
+	disabled.Name = "disabled-namespace"
+	disabled.Annotations = map[string]string{bypassAnnotationKey: "false"}
+	plain := cloneNamespace(templateNamespace)
+	plain.Name = "plain-namespace"
+	clientset = fake.NewSimpleClientset(annotated, disabled, plain)
+
+	refreshBypassAnnotatedNamespaces()
+	assert.Equal(t, float64(1), metricValue(bypassAnnotatedNamespaces), "should count the namespaces requesting a bypass")
+
+	stopCh := make(chan struct{})
+	defer close(stopCh)
+	objectCache = newResourceCache(informers.NewSharedInformerFactory(clientset, 0), nil, time.Minute, stopCh)
+	defer func() { objectCache = nil }()
+	assert.Nil(t, objectCache.warm([]schema.GroupVersionResource{namespacesResource}), "Error should be nil")
+	// the namespaces are read from the cache, not listed again
+	clientset = fake.NewSimpleClientset()
+
+	refreshBypassAnnotatedNamespaces()
+	assert.Equal(t, float64(1), metricValue(bypassAnnotatedNamespaces), "should count the cached namespaces requesting a bypass")
+}
@@ -0,0 +1,61 @@
+// Copyright 2017 Yahoo Holdings Inc. 
+// Licensed under the terms of the 3-Clause BSD License.
+package main
+
+import (
+	"fmt"
+
+	"github.com/Sirupsen/logrus"
+)
+
+// enforcementMode decides what happens to a namespace deletion that fails validation
+type enforcementMode string
+
+const (
+	// modeEnforce rejects the deletion
+	modeEnforce enforcementMode = "enforce"
+	// modeWarn allows the deletion, but logs, counts and returns the would-be rejection as an admission warning
+	modeWarn enforcementMode = "warn"
+	// modeOff allows the deletion without validation
+	modeOff enforcementMode = "off"
+
+	// modeLabelKey lets a namespace opt into an enforcement mode other than the cluster-wide default
+	modeLabelKey = "k8s-namespace-guard.admission.yahoo.com/mode"
+)
+
+var defaultMode = modeEnforce
+
+// parseEnforcementMode validates a mode given on the command line, in the policy file or in the namespace label
+func parseEnforcementMode(mode string) (enforcementMode, error) {
+	switch enforcementMode(mode) {
+	case modeEnforce, modeWarn, modeOff:
+		return enforcementMode(mode), nil
+	}
+	return "", fmt.Errorf("unknown enforcement mode %q, expected %s, %s or %s", mode, modeEnforce, modeWarn, modeOff)
+}
+
+// clusterMode returns the cluster-wide default mode, taken from the policy file if it sets one and from --mode otherwise
+func clusterMode() enforcementMode {
+	if mode := currentPolicy().Mode; mode != "" {
+		return mode
+	}
+	return defaultMode
+}
+
+// namespaceMode returns the mode selected by the namespace labels, falling back to the cluster-wide default
+// when the label is missing or invalid
+func namespaceMode(name string, labels map[string]string) enforcementMode {
+	value, ok := labels[modeLabelKey]
+	if !ok {
+		return clusterMode()
+	}
+	mode, err := parseEnforcementMode(value)
+	if err != nil {
+		log.WithFields(logrus.Fields{
+			"namespace": name,
+			"label":     modeLabelKey,
+		}).WithError(err).Warn("Ignoring the mode label")
+		return clusterMode()
+	}
+	return mode
+}
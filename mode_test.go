@@ -0,0 +1,127 @@
+// Copyright 2017 Yahoo Holdings Inc. 
+// Licensed under the terms of the 3-Clause BSD License.
+package main
+
+import (
+	"net/http/httptest"
+	"testing"
+
+	corev1 "k8s.io/api/core/v1"
+	"k8s.io/apimachinery/pkg/apis/meta/v1"
+	"k8s.io/client-go/kubernetes/fake"
+
+	"github.com/stretchr/testify/assert"
+)
+
+func TestParseEnforcementMode(t *testing.T) {
+	mode, err := parseEnforcementMode("warn")
+	assert.Nil(t, err, "Error should be nil")
+	assert.Equal(t, modeWarn, mode)
+
+	mode, err = parseEnforcementMode("enforce")
+	assert.Nil(t, err, "Error should be nil")
+	assert.Equal(t, modeEnforce, mode)
+
+	_, err = parseEnforcementMode("audit")
+	assert.NotNil(t, err, "should fail on an unknown mode")
+	assert.Contains(t, err.Error(), `unknown enforcement mode "audit"`)
+}
+
+func TestWarnModeWebhookHandler(t *testing.T) {
+	defaultMode = modeWarn
+	defer func() { defaultMode = modeEnforce }()
+
+	testPod := &corev1.Pod{
+		ObjectMeta: v1.ObjectMeta{
+			Name:      "test-pod",
+			Namespace: "test-namespace",
+		},
+	}
+	clientset = fake.NewSimpleClientset(testPod, cloneNamespace(templateNamespace))
+	warned := metricValue(admissionDecisions.WithLabelValues("allowed", reasonWarned, "DELETE"))
+
+	rw := httptest.NewRecorder()
+	req := httptest.NewRequest("POST", "http://localhost:8080/", constructV1PostBody(admissionV1, templateAdmReview))
+	webhookHandler(rw, req)
+
+	admReview := getV1AdmissionReview(rw)
+
+	assert.True(t, admReview.Response.Allowed, "should allow the deletion in warn mode")
+	assert.Len(t, admReview.Response.Warnings, 1)
+	assert.Contains(t, admReview.Response.Warnings[0], "k8s-namespace-guard would have rejected this deletion: The namespace test-namespace you are trying to remove contains one or more of these resources: [pods(1)].")
+	assert.Equal(t, warned+1, metricValue(admissionDecisions.WithLabelValues("allowed", reasonWarned, "DELETE")),
+		"should count the would-be rejection")
+}
+
+func TestWarnModeEmptyNamespaceWebhookHandler(t *testing.T) {
+	defaultMode = modeWarn
+	defer func() { defaultMode = modeEnforce }()
+
+	clientset = fake.NewSimpleClientset(cloneNamespace(templateNamespace))
+
+	rw := httptest.NewRecorder()
+	req := httptest.NewRequest("POST", "http://localhost:8080/", constructV1PostBody(admissionV1, templateAdmReview))
+	webhookHandler(rw, req)
+
+	admReview := getV1AdmissionReview(rw)
+
+	assert.True(t, admReview.Response.Allowed, "should allow the deletion of an empty namespace")
+	assert.Empty(t, admReview.Response.Warnings, "should not warn about an empty namespace")
+}
+
+func TestNamespaceMode(t *testing.T) {
+	assert.Equal(t, modeEnforce, namespaceMode("test-namespace", nil), "should use the cluster-wide default without the label")
+	assert.Equal(t, modeWarn, namespaceMode("test-namespace", map[string]string{modeLabelKey: "warn"}))
+	assert.Equal(t, modeOff, namespaceMode("test-namespace", map[string]string{modeLabelKey: "off"}))
+	assert.Equal(t, modeEnforce, namespaceMode("test-namespace", map[string]string{modeLabelKey: "audit"}), "should use the cluster-wide default if the label is invalid")
+}
+
+func TestPolicyMode(t *testing.T) {
+	defer activePolicy.Store(currentPolicy())
+	activePolicy.Store(&policy{Mode: modeWarn})
+
+	assert.Equal(t, modeWarn, clusterMode(), "the policy file mode should override --mode")
+	assert.Equal(t, modeWarn, namespaceMode("test-namespace", nil))
+	assert.Equal(t, modeEnforce, namespaceMode("test-namespace", map[string]string{modeLabelKey: "enforce"}))
+}
+
+func TestOffModeLabelWebhookHandler(t *testing.T) {
+	testPod := &corev1.Pod{
+		ObjectMeta: v1.ObjectMeta{
+			Name:      "test-pod",
+			Namespace: "test-namespace",
+		},
+	}
+	testNamespace := cloneNamespace(templateNamespace)
+	testNamespace.Labels = map[string]string{modeLabelKey: "off"}
+	clientset = fake.NewSimpleClientset(testPod, testNamespace)
+
+	rw := httptest.NewRecorder()
+	req := httptest.NewRequest("POST", "http://localhost:8080/", constructPostBody(cloneAdmissionReview(templateAdmReview)))
+	webhookHandler(rw, req)
+
+	assert.True(t, getAdmissionReview(rw).Status.Allowed, "should allow the deletion if the namespace opted out")
+}
+
+func TestEnforceModeLabelWebhookHandler(t *testing.T) {
+	defaultMode = modeWarn
+	defer func() { defaultMode = modeEnforce }()
+
+	testPod := &corev1.Pod{
+		ObjectMeta: v1.ObjectMeta{
+			Name:      "test-pod",
+			Namespace: "test-namespace",
+		},
+	}
+	testNamespace := cloneNamespace(templateNamespace)
+	testNamespace.Labels = map[string]string{modeLabelKey: "enforce"}
+	clientset = fake.NewSimpleClientset(testPod, testNamespace)
+
+	rw := httptest.NewRecorder()
+	req := httptest.NewRequest("POST", "http://localhost:8080/", constructPostBody(cloneAdmissionReview(templateAdmReview)))
+	webhookHandler(rw, req)
+
+	admReview := getAdmissionReview(rw)
+	assert.False(t, admReview.Status.Allowed, "should reject the deletion if the namespace opted into enforcement")
+	assert.Contains(t, admReview.Status.Result.Reason, "contains one or more of these resources: [pods(1)].")
+}
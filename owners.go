@@ -0,0 +1,100 @@
+// Copyright 2017 Yahoo Holdings Inc. 
+// Licensed under the terms of the 3-Clause BSD License.
+package main
+
+import (
+	"fmt"
+	"sort"
+	"strings"
+
+	"k8s.io/apimachinery/pkg/apis/meta/v1"
+	"k8s.io/apimachinery/pkg/types"
+)
+
+// listedObject is an object along with the kind of resources it was counted as
+type listedObject struct {
+	kind   string
+	object v1.Object
+}
+
+// listedOwner returns the owner of object among the listed objects, preferring its controller.
+func listedOwner(object v1.Object, byUID map[types.UID]listedObject) (listedObject, bool) {
+	refs := object.GetOwnerReferences()
+	for _, ref := range refs {
+		if ref.Controller != nil && *ref.Controller {
+			if owner, ok := byUID[ref.UID]; ok {
+				return owner, true
+			}
+		}
+	}
+	for _, ref := range refs {
+		if owner, ok := byUID[ref.UID]; ok {
+			return owner, true
+		}
+	}
+	return listedObject{}, false
+}
+
+// rootOwner follows the owner references of object up to its topmost owner among the listed objects.
+// An object without a listed owner is its own root.
+func rootOwner(object listedObject, byUID map[types.UID]listedObject) listedObject {
+	visited := map[types.UID]bool{object.object.GetUID(): true}
+	for {
+		owner, ok := listedOwner(object.object, byUID)
+		if !ok || visited[owner.object.GetUID()] {
+			return object
+		}
+		visited[owner.object.GetUID()] = true
+		object = owner
+	}
+}
+
+// rollUpOwners replaces the resources blocking a deletion by their topmost owners among the listed
+// objects, e.g. the pods and replicasets of a deployment by the deployment. Dependents counts the
+// resources rolled up into the owners of every kind.
+func rollUpOwners(blocking []blockingKind, listed []listedObject) []blockingKind {
+	byUID := map[types.UID]listedObject{}
+	for _, l := range listed {
+		if uid := l.object.GetUID(); uid != "" {
+			byUID[uid] = l
+		}
+	}
+
+	var rolledUp []blockingKind
+	index := map[string]int{}
+	seen := map[string]bool{}
+	for _, b := range blocking {
+		for _, object := range b.objects {
+			root := rootOwner(listedObject{kind: b.Kind, object: object}, byUID)
+			i, ok := index[root.kind]
+			if !ok {
+				i = len(rolledUp)
+				index[root.kind] = i
+				rolledUp = append(rolledUp, blockingKind{Kind: root.kind, Dependents: map[string]int{}})
+			}
+			if root.object != object {
+				rolledUp[i].Dependents[b.Kind]++
+			}
+			if key := root.kind + "/" + root.object.GetName(); !seen[key] {
+				seen[key] = true
+				rolledUp[i].objects = append(rolledUp[i].objects, root.object)
+				rolledUp[i].Count++
+			}
+		}
+	}
+	return rolledUp
+}
+
+// formatDependents returns the number of dependents of every kind, sorted by kind, e.g. "3 pods, 1 replicasets"
+func formatDependents(dependents map[string]int) string {
+	var kinds []string
+	for kind := range dependents {
+		kinds = append(kinds, kind)
+	}
+	sort.Strings(kinds)
+	parts := make([]string, len(kinds))
+	for i, kind := range kinds {
+		parts[i] = fmt.Sprintf("%d %s", dependents[kind], kind)
+	}
+	return strings.Join(parts, ", ")
+}
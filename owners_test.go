@@ -0,0 +1,90 @@
+// Copyright 2017 Yahoo Holdings Inc. 
+// Licensed under the terms of the 3-Clause BSD License.
+package main
+
+import (
+	"net/http/httptest"
+	"testing"
+
+	appsv1 "k8s.io/api/apps/v1"
+	corev1 "k8s.io/api/core/v1"
+	"k8s.io/apimachinery/pkg/apis/meta/v1"
+	"k8s.io/apimachinery/pkg/types"
+	"k8s.io/client-go/kubernetes/fake"
+
+	"github.com/stretchr/testify/assert"
+)
+
+func ownedMeta(name string, uid types.UID, ownerKind string, ownerUID types.UID) v1.ObjectMeta {
+	meta := v1.ObjectMeta{Name: name, Namespace: "test-namespace", UID: uid}
+	if ownerUID != "" {
+		controller := true
+		meta.OwnerReferences = []v1.OwnerReference{{Kind: ownerKind, Name: name, UID: ownerUID, Controller: &controller}}
+	}
+	return meta
+}
+
+func TestRollUpOwners(t *testing.T) {
+	deployment := &appsv1.Deployment{ObjectMeta: ownedMeta("web", "d1", "", "")}
+	replicaSet := &appsv1.ReplicaSet{ObjectMeta: ownedMeta("web-5d8f7", "r1", "Deployment", "d1")}
+	pods := []v1.Object{
+		&corev1.Pod{ObjectMeta: ownedMeta("web-5d8f7-a", "p1", "ReplicaSet", "r1")},
+		&corev1.Pod{ObjectMeta: ownedMeta("web-5d8f7-b", "p2", "ReplicaSet", "r1")},
+		&corev1.Pod{ObjectMeta: ownedMeta("debug", "p3", "", "")},
+		// the owning job is not counted, so the pod is its own root
+		&corev1.Pod{ObjectMeta: ownedMeta("migrate-x7k2p", "p4", "Job", "j1")},
+	}
+	listed := []listedObject{{kind: "deployments", object: deployment}, {kind: "replicasets", object: replicaSet}}
+	for _, pod := range pods {
+		listed = append(listed, listedObject{kind: "pods", object: pod})
+	}
+
+	rolledUp := rollUpOwners([]blockingKind{
+		{Kind: "pods", Count: 4, objects: pods},
+		{Kind: "replicasets", Count: 1, objects: []v1.Object{replicaSet}},
+	}, listed)
+
+	if assert.Len(t, rolledUp, 2) {
+		assert.Equal(t, "deployments", rolledUp[0].Kind)
+		assert.Equal(t, 1, rolledUp[0].Count, "should report the deployment once")
+		assert.Equal(t, map[string]int{"pods": 2, "replicasets": 1}, rolledUp[0].Dependents)
+		assert.Equal(t, "pods", rolledUp[1].Kind)
+		assert.Equal(t, 2, rolledUp[1].Count, "should report the pods without a counted owner")
+		assert.Empty(t, rolledUp[1].Dependents)
+	}
+}
+
+func TestRollUpOwnerCycle(t *testing.T) {
+	a := &corev1.Pod{ObjectMeta: ownedMeta("a", "a", "Pod", "b")}
+	b := &corev1.Pod{ObjectMeta: ownedMeta("b", "b", "Pod", "a")}
+	listed := []listedObject{{kind: "pods", object: a}, {kind: "pods", object: b}}
+
+	rolledUp := rollUpOwners([]blockingKind{{Kind: "pods", Count: 2, objects: []v1.Object{a, b}}}, listed)
+	if assert.Len(t, rolledUp, 1, "should stop following owner references in a cycle") {
+		assert.Equal(t, 2, rolledUp[0].Count)
+	}
+}
+
+func TestRollUpOwnersWebhookHandler(t *testing.T) {
+	defer func(value bool) { *ownerRollUp = value }(*ownerRollUp)
+	*ownerRollUp = true
+
+	clientset = fake.NewSimpleClientset(
+		&appsv1.Deployment{ObjectMeta: ownedMeta("web", "d1", "", "")},
+		&appsv1.ReplicaSet{ObjectMeta: ownedMeta("web-5d8f7", "r1", "Deployment", "d1")},
+		&corev1.Pod{ObjectMeta: ownedMeta("web-5d8f7-a", "p1", "ReplicaSet", "r1")},
+		&corev1.Pod{ObjectMeta: ownedMeta("web-5d8f7-b", "p2", "ReplicaSet", "r1")},
+		cloneNamespace(templateNamespace),
+	)
+
+	rw := httptest.NewRecorder()
+	req := httptest.NewRequest("POST", "http://localhost:8080/", constructPostBody(cloneAdmissionReview(templateAdmReview)))
+	webhookHandler(rw, req)
+
+	admReview := getAdmissionReview(rw)
+	assert.False(t, admReview.Status.Allowed, "should reject if the namespace has a deployment")
+	assert.Contains(t, admReview.Status.Result.Reason, "contains one or more of these resources: [deployments(1)].")
+	assert.Contains(t, admReview.Status.Result.Reason, "deployments: web (owning 2 pods, 1 replicasets)")
+	assert.Equal(t, []v1.StatusCause{{Type: causeTypeBlockingResources, Field: "deployments", Message: "1 deployments: web (owning 2 pods, 1 replicasets)"}},
+		admReview.Status.Result.Details.Causes)
+}
@@ -0,0 +1,296 @@
+// Copyright 2017 Yahoo Holdings Inc. 
+// Licensed under the terms of the 3-Clause BSD License.
+package main
+
+import (
+	"bytes"
+	"encoding/json"
+	"fmt"
+	"io/ioutil"
+	"strings"
+	"sync/atomic"
+
+	"github.com/ghodss/yaml"
+	"k8s.io/apimachinery/pkg/runtime/schema"
+)
+
+// activePolicy holds the *policy in effect, which is swapped atomically when the policy file is reloaded
+var activePolicy atomic.Value
+
+// currentPolicy returns the policy in effect
+func currentPolicy() *policy {
+	return activePolicy.Load().(*policy)
+}
+
+// policy decides which resource types block a namespace deletion. It is loaded from the --policyFile
+// YAML or JSON document, or built from the --includeResources and --excludeResources flags.
+type policy struct {
+	// Resources lists the resource types that block a namespace deletion. When empty, the built-in
+	// list is used, or every discovered resource type in discovery mode.
+	Resources []resourceRule `json:"resources,omitempty"`
+	// Exclude lists group/resources that never block a namespace deletion, on top of the default
+	// exclusions that Resources does not list.
+	Exclude []string `json:"exclude,omitempty"`
+	// Mode is the cluster-wide enforcement mode of namespaces without the mode label. It overrides --mode.
+	Mode enforcementMode `json:"mode,omitempty"`
+	// Protected lists the namespaces that can never be deleted.
+	Protected protectedNamespaces `json:"protectedNamespaces,omitempty"`
+	// Bypass configures what it takes for the bypass annotation to be honored.
+	Bypass bypassPolicy `json:"bypass,omitempty"`
+	// Allowlist lists the identities that may delete namespaces without validation.
+	Allowlist identityAllowlist `json:"allowlist,omitempty"`
+	// Messages replaces the messages returned to the client.
+	Messages messageTemplates `json:"messages,omitempty"`
+	// Ignore lists the objects that are not counted, on top of the built-in rules.
+	Ignore []ignoreRule `json:"ignore,omitempty"`
+	// Counting decides whether terminating objects and pods in terminal phases are counted.
+	Counting countingPolicy `json:"counting,omitempty"`
+	// Dependencies decides which references from other namespaces block the deletion or are warned about.
+	Dependencies dependencyPolicy `json:"dependencies,omitempty"`
+
+	filter *groupResourceFilter
+}
+
+// resourceRule is a resource type that blocks a namespace deletion.
+type resourceRule struct {
+	// Resource is the group/resource, e.g. "pods", "apps/deployments" or "argoproj.io/*".
+	// The names of the built-in list, e.g. "deployments", may be used without a group.
+	Resource string `json:"resource"`
+	// Version is the API version used to list resources outside the built-in list when discovery
+	// mode is off. It defaults to v1 for the core group.
+	Version string `json:"version,omitempty"`
+	// Threshold is the number of resources tolerated before the deletion is blocked,
+	// e.g. 1 blocks the deletion if there is more than one resource of this type.
+	Threshold int `json:"threshold,omitempty"`
+
+	groupResource schema.GroupResource
+}
+
+// newFlagPolicy builds the policy from the comma separated include and exclude lists of the command line.
+func newFlagPolicy(include, exclude string, discovery bool) (*policy, error) {
+	includeList, err := parseGroupResources(include)
+	if err != nil {
+		return nil, fmt.Errorf("error parsing the included resources: %v", err)
+	}
+	p := &policy{}
+	for _, groupResource := range includeList {
+		p.Resources = append(p.Resources, resourceRule{Resource: formatGroupResource(groupResource)})
+	}
+	for _, entry := range strings.Split(exclude, ",") {
+		if entry = strings.TrimSpace(entry); entry != "" {
+			p.Exclude = append(p.Exclude, entry)
+		}
+	}
+	if err := p.validate(discovery); err != nil {
+		return nil, err
+	}
+	return p, nil
+}
+
+// loadPolicy reads and validates the policy from a YAML or JSON file. Unknown fields are rejected so that
+// typos do not silently weaken the policy.
+func loadPolicy(filename string, discovery bool) (*policy, error) {
+	data, err := ioutil.ReadFile(filename)
+	if err != nil {
+		return nil, fmt.Errorf("error reading the policy file %s: %v", filename, err)
+	}
+	jsonData, err := yaml.YAMLToJSON(data)
+	if err != nil {
+		return nil, fmt.Errorf("error parsing the policy file %s: %v", filename, err)
+	}
+
+	p := &policy{}
+	decoder := json.NewDecoder(bytes.NewReader(jsonData))
+	decoder.DisallowUnknownFields()
+	if err := decoder.Decode(p); err != nil {
+		return nil, fmt.Errorf("error parsing the policy file %s: %v", filename, err)
+	}
+	p.Exclude = append(defaultExcludes(p.Resources), p.Exclude...)
+	if err := p.validate(discovery); err != nil {
+		return nil, fmt.Errorf("invalid policy file %s: %v", filename, err)
+	}
+	return p, nil
+}
+
+// defaultExcludes returns the entries of defaultExcludedResources matching none of the resources, which a
+// policy file may list to have them block a deletion after all.
+func defaultExcludes(resources []resourceRule) []string {
+	var excludes []string
+	for _, entry := range strings.Split(defaultExcludedResources, ",") {
+		excluded, err := parseGroupResources(entry)
+		if err != nil {
+			continue
+		}
+		listed := false
+		for _, rule := range resources {
+			groupResources, err := parseGroupResources(rule.Resource)
+			if err == nil && len(groupResources) == 1 && matchesGroupResource(excluded, resolveGroupResource(groupResources[0])) {
+				listed = true
+				break
+			}
+		}
+		if !listed {
+			excludes = append(excludes, entry)
+		}
+	}
+	return excludes
+}
+
+// formatGroupResource is the inverse of parseGroupResources for a single entry.
+func formatGroupResource(groupResource schema.GroupResource) string {
+	if groupResource.Group == "" {
+		return groupResource.Resource
+	}
+	return groupResource.Group + "/" + groupResource.Resource
+}
+
+// validate checks the policy and prepares it for use.
+func (p *policy) validate(discovery bool) error {
+	if p.Mode != "" {
+		if _, err := parseEnforcementMode(string(p.Mode)); err != nil {
+			return fmt.Errorf("mode: %v", err)
+		}
+	}
+	if err := p.Protected.validate(); err != nil {
+		return fmt.Errorf("protectedNamespaces: %v", err)
+	}
+	if err := p.Allowlist.validate(); err != nil {
+		return fmt.Errorf("allowlist: %v", err)
+	}
+	if err := p.Messages.validate(); err != nil {
+		return fmt.Errorf("messages: %v", err)
+	}
+	if err := p.Counting.validate(); err != nil {
+		return fmt.Errorf("counting: %v", err)
+	}
+	if err := p.Dependencies.validate(); err != nil {
+		return fmt.Errorf("dependencies: %v", err)
+	}
+	for i := range p.Ignore {
+		if err := p.Ignore[i].validate(); err != nil {
+			return fmt.Errorf("ignore[%d]: %v", i, err)
+		}
+	}
+
+	seen := map[schema.GroupResource]bool{}
+	var include []schema.GroupResource
+	for i := range p.Resources {
+		rule := &p.Resources[i]
+		groupResources, err := parseGroupResources(rule.Resource)
+		if err != nil || len(groupResources) != 1 {
+			return fmt.Errorf("resources[%d]: invalid group/resource %q", i, rule.Resource)
+		}
+		rule.groupResource = resolveGroupResource(groupResources[0])
+		if seen[rule.groupResource] {
+			return fmt.Errorf("resources[%d]: %q is listed more than once", i, rule.Resource)
+		}
+		seen[rule.groupResource] = true
+		if rule.Threshold < 0 {
+			return fmt.Errorf("resources[%d]: threshold of %q must not be negative", i, rule.Resource)
+		}
+		if !discovery {
+			if rule.groupResource.Resource == "*" {
+				return fmt.Errorf("resources[%d]: wildcard %q requires discovery mode", i, rule.Resource)
+			}
+			if _, ok := staticCounterFor(rule.groupResource); !ok && rule.Version == "" && rule.groupResource.Group != "" {
+				return fmt.Errorf("resources[%d]: version is required for %q unless discovery mode is enabled", i, rule.Resource)
+			}
+		}
+		include = append(include, rule.groupResource)
+	}
+
+	exclude, err := parseGroupResources(strings.Join(p.Exclude, ","))
+	if err != nil {
+		return fmt.Errorf("exclude: %v", err)
+	}
+	for i, groupResource := range exclude {
+		exclude[i] = resolveGroupResource(groupResource)
+		if seen[exclude[i]] {
+			return fmt.Errorf("exclude: %q is also listed in resources", formatGroupResource(groupResource))
+		}
+	}
+
+	p.filter = &groupResourceFilter{include: include, exclude: exclude}
+	return nil
+}
+
+// ruleFor returns the rule matching groupResource, preferring an exact match over a group wildcard.
+func (p *policy) ruleFor(groupResource schema.GroupResource) (resourceRule, bool) {
+	var wildcard *resourceRule
+	for i, rule := range p.Resources {
+		if rule.groupResource == groupResource {
+			return rule, true
+		}
+		if rule.groupResource.Group == groupResource.Group && rule.groupResource.Resource == "*" {
+			wildcard = &p.Resources[i]
+		}
+	}
+	if wildcard != nil {
+		return *wildcard, true
+	}
+	return resourceRule{}, false
+}
+
+// resolveGroupResource returns the group/resource of the built-in counter named by a plain name such as
+// "deployments", which would otherwise never match apps/deployments in discovery mode. Other names are returned as is.
+func resolveGroupResource(groupResource schema.GroupResource) schema.GroupResource {
+	if c, ok := staticCounterFor(groupResource); ok {
+		return c.gvr.GroupResource()
+	}
+	return groupResource
+}
+
+// staticCounterFor returns the built-in counter for groupResource, which may also be given by its plain name.
+func staticCounterFor(groupResource schema.GroupResource) (resourceCounter, bool) {
+	for _, c := range staticCounters {
+		if c.gvr.GroupResource() == groupResource || (groupResource.Group == "" && groupResource.Resource == c.kind) {
+			return c, true
+		}
+	}
+	return resourceCounter{}, false
+}
+
+// counters returns the counters of the resource types that block a namespace deletion, along with their thresholds.
+func (p *policy) counters(discovery bool) ([]resourceCounter, error) {
+	if discovery {
+		counters, err := discoverCounters(p.filter)
+		for i := range counters {
+			if rule, ok := p.ruleFor(counters[i].gvr.GroupResource()); ok {
+				counters[i].threshold = rule.Threshold
+			}
+		}
+		return counters, err
+	}
+
+	var counters []resourceCounter
+	if len(p.Resources) == 0 {
+		for _, c := range staticCounters {
+			if p.excludes(c) {
+				continue
+			}
+			counters = append(counters, c)
+		}
+		return counters, nil
+	}
+
+	for _, rule := range p.Resources {
+		c, ok := staticCounterFor(rule.groupResource)
+		if !ok {
+			version := rule.Version
+			if version == "" {
+				version = "v1"
+			}
+			gvr := rule.groupResource.WithVersion(version)
+			c = resourceCounter{kind: rule.groupResource.String(), gvr: gvr, counter: dynamicCounter(gvr)}
+		}
+		c.threshold = rule.Threshold
+		counters = append(counters, c)
+	}
+	return counters, nil
+}
+
+// excludes returns true if the built-in counter c is excluded, either by group/resource or by its plain name.
+func (p *policy) excludes(c resourceCounter) bool {
+	return matchesGroupResource(p.filter.exclude, c.gvr.GroupResource()) ||
+		matchesGroupResource(p.filter.exclude, schema.GroupResource{Resource: c.kind})
+}
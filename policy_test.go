@@ -0,0 +1,184 @@
+// Copyright 2017 Yahoo Holdings Inc. 
+// Licensed under the terms of the 3-Clause BSD License.
+package main
+
+import (
+	"io/ioutil"
+	"net/http/httptest"
+	"os"
+	"testing"
+
+	"k8s.io/apimachinery/pkg/runtime"
+	"k8s.io/apimachinery/pkg/runtime/schema"
+	dynamicfake "k8s.io/client-go/dynamic/fake"
+	"k8s.io/client-go/kubernetes/fake"
+
+	"github.com/stretchr/testify/assert"
+)
+
+const testPolicyYAML = `
+resources:
+- resource: pods
+- resource: deployments
+- resource: secrets
+  threshold: 1
+- resource: batch/cronjobs
+  version: v1beta1
+exclude:
+- configmaps
+`
+
+func writePolicyFile(content string) string {
+	file, err := ioutil.TempFile("", "policy")
+	if err != nil {
+		panic(err.Error())
+	}
+	defer file.Close()
+	if _, err := file.WriteString(content); err != nil {
+		panic(err.Error())
+	}
+	return file.Name()
+}
+
+func TestLoadPolicy(t *testing.T) {
+	filename := writePolicyFile(testPolicyYAML)
+	defer os.Remove(filename)
+
+	testPolicy, err := loadPolicy(filename, false)
+	assert.Nil(t, err, "Error should be nil")
+
+	counters, err := testPolicy.counters(false)
+	assert.Nil(t, err, "Error should be nil")
+
+	var kinds []string
+	for _, c := range counters {
+		kinds = append(kinds, c.kind)
+	}
+	assert.Equal(t, []string{"pods", "deployments", "secrets", "cronjobs.batch"}, kinds)
+	assert.Equal(t, schema.GroupVersionResource{Group: "apps", Version: "v1", Resource: "deployments"}, counters[1].gvr)
+	assert.Equal(t, schema.GroupVersionResource{Group: "", Version: "v1", Resource: "secrets"}, counters[2].gvr)
+	assert.Equal(t, 1, counters[2].threshold)
+	assert.Equal(t, schema.GroupVersionResource{Group: "batch", Version: "v1beta1", Resource: "cronjobs"}, counters[3].gvr)
+}
+
+func TestLoadJSONPolicy(t *testing.T) {
+	filename := writePolicyFile(`{"resources": [{"resource": "pods", "threshold": 2}]}`)
+	defer os.Remove(filename)
+
+	testPolicy, err := loadPolicy(filename, false)
+	assert.Nil(t, err, "Error should be nil")
+	assert.Equal(t, 2, testPolicy.Resources[0].Threshold)
+}
+
+func TestInvalidPolicy(t *testing.T) {
+	invalidPolicies := []struct {
+		content  string
+		errorMsg string
+	}{
+		{"resources:\n- resource: pods\n  treshold: 1\n", `unknown field "treshold"`},
+		{"resources:\n- resource: apps/v1/deployments\n", `resources[0]: invalid group/resource "apps/v1/deployments"`},
+		{"resources:\n- resource: pods\n- resource: pods\n", `resources[1]: "pods" is listed more than once`},
+		{"resources:\n- resource: deployments\n- resource: apps/deployments\n", `resources[1]: "apps/deployments" is listed more than once`},
+		{"resources:\n- resource: secrets\n  threshold: -1\n", `resources[0]: threshold of "secrets" must not be negative`},
+		{"resources:\n- resource: argoproj.io/*\n", `resources[0]: wildcard "argoproj.io/*" requires discovery mode`},
+		{"resources:\n- resource: argoproj.io/rollouts\n", `resources[0]: version is required for "argoproj.io/rollouts" unless discovery mode is enabled`},
+		{"resources:\n- resource: secrets\nexclude:\n- secrets\n", `exclude: "secrets" is also listed in resources`},
+		{"mode: audit\n", `mode: unknown enforcement mode "audit"`},
+		{"allowlist:\n  serviceAccounts:\n  - lifecycle-controller\n", `allowlist: serviceAccounts[0]: invalid service account "lifecycle-controller"`},
+	}
+
+	for _, invalidPolicy := range invalidPolicies {
+		filename := writePolicyFile(invalidPolicy.content)
+		_, err := loadPolicy(filename, false)
+		os.Remove(filename)
+
+		assert.NotNil(t, err, "should reject the policy %q", invalidPolicy.content)
+		if err != nil {
+			assert.Contains(t, err.Error(), invalidPolicy.errorMsg)
+		}
+	}
+}
+
+func TestMissingPolicyFile(t *testing.T) {
+	_, err := loadPolicy("/nonexistent/policy.yaml", false)
+	assert.NotNil(t, err, "should fail if the policy file does not exist")
+	assert.Contains(t, err.Error(), "error reading the policy file /nonexistent/policy.yaml")
+}
+
+func TestDiscoveryPolicyPlainNames(t *testing.T) {
+	filename := writePolicyFile("resources:\n- resource: deployments\n  threshold: 2\n- resource: pods\nexclude:\n- daemonsets\n")
+	defer os.Remove(filename)
+
+	testPolicy, err := loadPolicy(filename, true)
+	assert.Nil(t, err, "Error should be nil")
+	rule, ok := testPolicy.ruleFor(schema.GroupResource{Group: "apps", Resource: "deployments"})
+	assert.True(t, ok, "should resolve the plain name to the group of the built-in counter")
+	assert.Equal(t, 2, rule.Threshold)
+	assert.Equal(t, []schema.GroupResource{{Group: "apps", Resource: "deployments"}, {Resource: "pods"}}, testPolicy.filter.include)
+	assert.Contains(t, testPolicy.filter.exclude, schema.GroupResource{Group: "apps", Resource: "daemonsets"})
+}
+
+func TestPolicyFileDefaultExcludes(t *testing.T) {
+	filename := writePolicyFile("resources:\n- resource: pods\n- resource: secrets\n- resource: metrics.k8s.io/pods\nexclude:\n- argoproj.io/*\n")
+	defer os.Remove(filename)
+
+	testPolicy, err := loadPolicy(filename, true)
+	assert.Nil(t, err, "Error should be nil")
+	assert.False(t, testPolicy.filter.allows(schema.GroupResource{Resource: "events"}), "should exclude the default exclusions")
+	assert.False(t, testPolicy.filter.allows(schema.GroupResource{Group: "coordination.k8s.io", Resource: "leases"}), "should exclude the default exclusions")
+	assert.False(t, testPolicy.filter.allows(schema.GroupResource{Group: "argoproj.io", Resource: "rollouts"}), "should exclude the listed exclusions")
+	assert.True(t, testPolicy.filter.allows(schema.GroupResource{Resource: "secrets"}), "should count the listed resources excluded by default")
+	assert.True(t, testPolicy.filter.allows(schema.GroupResource{Group: "metrics.k8s.io", Resource: "pods"}), "should count the listed resources excluded by default")
+
+	filename = writePolicyFile("exclude:\n- argoproj.io/*\n")
+	defer os.Remove(filename)
+	testPolicy, err = loadPolicy(filename, true)
+	assert.Nil(t, err, "Error should be nil")
+	assert.False(t, testPolicy.filter.allows(schema.GroupResource{Resource: "endpoints"}), "should exclude the default exclusions without resources")
+	assert.True(t, testPolicy.filter.allows(schema.GroupResource{Group: "apps", Resource: "deployments"}))
+}
+
+func TestExcludedStaticCounters(t *testing.T) {
+	testPolicy, err := newFlagPolicy("", "pods,apps/deployments", false)
+	assert.Nil(t, err, "Error should be nil")
+
+	counters, err := testPolicy.counters(false)
+	assert.Nil(t, err, "Error should be nil")
+	for _, c := range counters {
+		assert.NotEqual(t, "pods", c.kind, "pods should be excluded")
+		assert.NotEqual(t, "deployments", c.kind, "deployments should be excluded")
+	}
+	assert.Len(t, counters, len(staticCounters)-2)
+}
+
+func TestPolicyThresholdWebhookHandler(t *testing.T) {
+	filename := writePolicyFile(testPolicyYAML)
+	defer os.Remove(filename)
+	testPolicy, err := loadPolicy(filename, false)
+	assert.Nil(t, err, "Error should be nil")
+	defer activePolicy.Store(currentPolicy())
+	activePolicy.Store(testPolicy)
+
+	clientset = fake.NewSimpleClientset(cloneNamespace(templateNamespace))
+
+	dynamicClient = dynamicfake.NewSimpleDynamicClient(runtime.NewScheme(),
+		newUnstructured("v1", "Secret", "test-namespace", "test-secret"),
+	)
+	rw := httptest.NewRecorder()
+	req := httptest.NewRequest("POST", "http://localhost:8080/", constructPostBody(cloneAdmissionReview(templateAdmReview)))
+	webhookHandler(rw, req)
+
+	assert.True(t, getAdmissionReview(rw).Status.Allowed, "should approve if the number of secrets does not exceed the threshold")
+
+	dynamicClient = dynamicfake.NewSimpleDynamicClient(runtime.NewScheme(),
+		newUnstructured("v1", "Secret", "test-namespace", "test-secret"),
+		newUnstructured("v1", "Secret", "test-namespace", "other-secret"),
+	)
+	rw = httptest.NewRecorder()
+	req = httptest.NewRequest("POST", "http://localhost:8080/", constructPostBody(cloneAdmissionReview(templateAdmReview)))
+	webhookHandler(rw, req)
+
+	admReview := getAdmissionReview(rw)
+	assert.False(t, admReview.Status.Allowed, "should reject if the number of secrets exceeds the threshold")
+	assert.Contains(t, admReview.Status.Result.Reason, "contains one or more of these resources: [secrets(2)].")
+}
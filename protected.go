@@ -0,0 +1,89 @@
+// Copyright 2017 Yahoo Holdings Inc. 
+// Licensed under the terms of the 3-Clause BSD License.
+package main
+
+import (
+	"fmt"
+	"path"
+	"regexp"
+	"strings"
+
+	"k8s.io/apimachinery/pkg/labels"
+)
+
+// builtinProtectedNamespaces can never be deleted, whatever the policy says
+var builtinProtectedNamespaces = []string{"kube-system", "kube-public", "kube-node-lease", "default"}
+
+// protectedNamespaces lists the namespaces that can never be deleted, regardless of their content,
+// enforcement mode or bypass annotation.
+type protectedNamespaces struct {
+	// Names are exact namespace names, added to the built-in list.
+	Names []string `json:"names,omitempty"`
+	// Patterns are shell globs such as "platform-*", or regular expressions when enclosed in slashes
+	// such as "/^team-[0-9]+-prod$/".
+	Patterns []string `json:"patterns,omitempty"`
+	// Selector is a label selector such as "guard.yahoo.com/protected=true".
+	Selector string `json:"selector,omitempty"`
+
+	regexps  map[string]*regexp.Regexp
+	selector labels.Selector
+}
+
+// validate checks the patterns and the selector and prepares them for matching.
+func (p *protectedNamespaces) validate() error {
+	p.regexps = map[string]*regexp.Regexp{}
+	for i, pattern := range p.Patterns {
+		if len(pattern) > 1 && strings.HasPrefix(pattern, "/") && strings.HasSuffix(pattern, "/") {
+			re, err := regexp.Compile(pattern[1 : len(pattern)-1])
+			if err != nil {
+				return fmt.Errorf("patterns[%d]: invalid regular expression %q: %v", i, pattern, err)
+			}
+			p.regexps[pattern] = re
+			continue
+		}
+		if _, err := path.Match(pattern, ""); err != nil {
+			return fmt.Errorf("patterns[%d]: invalid glob %q: %v", i, pattern, err)
+		}
+	}
+
+	p.selector = labels.Nothing()
+	if p.Selector != "" {
+		selector, err := labels.Parse(p.Selector)
+		if err != nil {
+			return fmt.Errorf("selector: invalid label selector %q: %v", p.Selector, err)
+		}
+		p.selector = selector
+	}
+	return nil
+}
+
+// match returns why the namespace is protected, or false if it is not.
+func (p *protectedNamespaces) match(name string, namespaceLabels map[string]string) (string, bool) {
+	if containsString(builtinProtectedNamespaces, name) || containsString(p.Names, name) {
+		return "it is in the list of protected namespaces", true
+	}
+	for _, pattern := range p.Patterns {
+		if re, ok := p.regexps[pattern]; ok {
+			if re.MatchString(name) {
+				return fmt.Sprintf("it matches the protected pattern %s", pattern), true
+			}
+			continue
+		}
+		if matched, _ := path.Match(pattern, name); matched {
+			return fmt.Sprintf("it matches the protected pattern %s", pattern), true
+		}
+	}
+	if p.selector != nil && p.selector.Matches(labels.Set(namespaceLabels)) {
+		return fmt.Sprintf("its labels match the protected selector %s", p.Selector), true
+	}
+	return "", false
+}
+
+func containsString(list []string, s string) bool {
+	for _, entry := range list {
+		if entry == s {
+			return true
+		}
+	}
+	return false
+}
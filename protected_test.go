@@ -0,0 +1,110 @@
+// Copyright 2017 Yahoo Holdings Inc. 
+// Licensed under the terms of the 3-Clause BSD License.
+package main
+
+import (
+	"net/http/httptest"
+	"testing"
+
+	corev1 "k8s.io/api/core/v1"
+	"k8s.io/apimachinery/pkg/apis/meta/v1"
+	"k8s.io/client-go/kubernetes/fake"
+
+	"github.com/stretchr/testify/assert"
+)
+
+func TestProtectedNamespacesMatch(t *testing.T) {
+	protected := protectedNamespaces{
+		Names:    []string{"platform"},
+		Patterns: []string{"platform-*", "/^team-[0-9]+-prod$/"},
+		Selector: "guard.yahoo.com/protected=true",
+	}
+	assert.Nil(t, protected.validate(), "Error should be nil")
+
+	for _, name := range []string{"kube-system", "kube-public", "default", "platform", "platform-ingress", "team-42-prod"} {
+		_, ok := protected.match(name, nil)
+		assert.True(t, ok, "%s should be protected", name)
+	}
+	for _, name := range []string{"test-namespace", "team-42-dev", "kube-system-copy"} {
+		_, ok := protected.match(name, nil)
+		assert.False(t, ok, "%s should not be protected", name)
+	}
+
+	reason, ok := protected.match("test-namespace", map[string]string{"guard.yahoo.com/protected": "true"})
+	assert.True(t, ok, "namespaces matching the selector should be protected")
+	assert.Equal(t, "its labels match the protected selector guard.yahoo.com/protected=true", reason)
+}
+
+func TestInvalidProtectedNamespaces(t *testing.T) {
+	protected := protectedNamespaces{Patterns: []string{"/team-[/"}}
+	err := protected.validate()
+	assert.NotNil(t, err, "should fail on an invalid regular expression")
+	assert.Contains(t, err.Error(), `patterns[0]: invalid regular expression "/team-[/"`)
+
+	protected = protectedNamespaces{Patterns: []string{"platform-["}}
+	err = protected.validate()
+	assert.NotNil(t, err, "should fail on an invalid glob")
+	assert.Contains(t, err.Error(), `patterns[0]: invalid glob "platform-["`)
+
+	protected = protectedNamespaces{Selector: "guard.yahoo.com/protected in (true"}
+	err = protected.validate()
+	assert.NotNil(t, err, "should fail on an invalid selector")
+	assert.Contains(t, err.Error(), "selector: invalid label selector")
+}
+
+func TestProtectedNamespaceWebhookHandler(t *testing.T) {
+	testNamespace := cloneNamespace(templateNamespace)
+	testNamespace.Name = "kube-system"
+	testNamespace.Annotations = map[string]string{bypassAnnotationKey: "true"}
+	testNamespace.Labels = map[string]string{modeLabelKey: "off"}
+	clientset = fake.NewSimpleClientset(testNamespace)
+
+	testSpec := cloneAdmissionReview(templateAdmReview)
+	testSpec.Spec.Name = "kube-system"
+	testSpec.Spec.Namespace = "kube-system"
+
+	rw := httptest.NewRecorder()
+	req := httptest.NewRequest("POST", "http://localhost:8080/", constructPostBody(testSpec))
+	webhookHandler(rw, req)
+
+	admReview := getAdmissionReview(rw)
+	assert.False(t, admReview.Status.Allowed, "should reject the deletion of a protected namespace even with the bypass annotation")
+	assert.Contains(t, admReview.Status.Result.Reason, "The namespace kube-system is protected and can never be deleted: it is in the list of protected namespaces.")
+}
+
+func TestProtectedSelectorWebhookHandler(t *testing.T) {
+	testPolicy := &policy{Protected: protectedNamespaces{Selector: "guard.yahoo.com/protected=true"}}
+	assert.Nil(t, testPolicy.validate(false), "Error should be nil")
+	defer activePolicy.Store(currentPolicy())
+	activePolicy.Store(testPolicy)
+
+	testNamespace := cloneNamespace(templateNamespace)
+	testNamespace.Labels = map[string]string{"guard.yahoo.com/protected": "true"}
+	clientset = fake.NewSimpleClientset(testNamespace)
+
+	rw := httptest.NewRecorder()
+	req := httptest.NewRequest("POST", "http://localhost:8080/", constructPostBody(cloneAdmissionReview(templateAdmReview)))
+	webhookHandler(rw, req)
+
+	admReview := getAdmissionReview(rw)
+	assert.False(t, admReview.Status.Allowed, "should reject the deletion of an empty namespace matching the protected selector")
+	assert.Contains(t, admReview.Status.Result.Reason, "its labels match the protected selector guard.yahoo.com/protected=true")
+}
+
+func TestUnprotectedNamespaceWebhookHandler(t *testing.T) {
+	testPod := &corev1.Pod{
+		ObjectMeta: v1.ObjectMeta{
+			Name:      "test-pod",
+			Namespace: "test-namespace",
+		},
+	}
+	testNamespace := cloneNamespace(templateNamespace)
+	testNamespace.Annotations = map[string]string{bypassAnnotationKey: "true", bypassReasonAnnotationKey: "decommissioning test-namespace"}
+	clientset = fake.NewSimpleClientset(testPod, testNamespace)
+
+	rw := httptest.NewRecorder()
+	req := httptest.NewRequest("POST", "http://localhost:8080/", constructPostBody(cloneAdmissionReview(templateAdmReview)))
+	webhookHandler(rw, req)
+
+	assert.True(t, getAdmissionReview(rw).Status.Allowed, "the bypass annotation should still apply to namespaces that are not protected")
+}
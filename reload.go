@@ -0,0 +1,151 @@
+// Copyright 2017 Yahoo Holdings Inc. 
+// Licensed under the terms of the 3-Clause BSD License.
+package main
+
+import (
+	"crypto/sha256"
+	"crypto/tls"
+	"crypto/x509"
+	"encoding/hex"
+	"fmt"
+	"io/ioutil"
+	"sync/atomic"
+	"time"
+)
+
+// tlsReloader serves the https certificate and the client CA pool, both of which can be reloaded
+// from disk while the server is running.
+type tlsReloader struct {
+	certFile   string
+	keyFile    string
+	caFile     string
+	clientAuth bool
+
+	cert   atomic.Value // *tls.Certificate
+	caPool atomic.Value // *x509.CertPool
+}
+
+func newTLSReloader(certFile, keyFile, caFile string, clientAuth bool) (*tlsReloader, error) {
+	r := &tlsReloader{certFile: certFile, keyFile: keyFile, caFile: caFile, clientAuth: clientAuth}
+	if err := r.loadCertificate(); err != nil {
+		return nil, err
+	}
+	if err := r.loadClientCA(); err != nil {
+		return nil, err
+	}
+	return r, nil
+}
+
+// loadCertificate reads the https server cert and key, keeping the current pair if they are invalid.
+func (r *tlsReloader) loadCertificate() error {
+	xcert, err := tls.LoadX509KeyPair(r.certFile, r.keyFile)
+	if err != nil {
+		return fmt.Errorf("unable to read the server cert and/or key file: %v", err)
+	}
+	r.cert.Store(&xcert)
+	return nil
+}
+
+// loadClientCA reads the cluster CA that signs the client(apiserver) cert, keeping the current pool if it is invalid.
+func (r *tlsReloader) loadClientCA() error {
+	caCert, err := ioutil.ReadFile(r.caFile)
+	if err != nil {
+		return fmt.Errorf("couldn't load file: %v", err)
+	}
+	caCertPool := x509.NewCertPool()
+	if !caCertPool.AppendCertsFromPEM(caCert) {
+		return fmt.Errorf("no PEM encoded certificates found in %s", r.caFile)
+	}
+	r.caPool.Store(caCertPool)
+	return nil
+}
+
+// getCertificate is the tls.Config.GetCertificate callback returning the current server certificate.
+func (r *tlsReloader) getCertificate(hello *tls.ClientHelloInfo) (*tls.Certificate, error) {
+	return r.cert.Load().(*tls.Certificate), nil
+}
+
+// getConfigForClient is the tls.Config.GetConfigForClient callback, so that every handshake verifies
+// the client against the current CA pool.
+func (r *tlsReloader) getConfigForClient(hello *tls.ClientHelloInfo) (*tls.Config, error) {
+	return r.tlsConfig(), nil
+}
+
+// tlsConfig returns the TLS config for the https server built from the current cert and CA pool.
+func (r *tlsReloader) tlsConfig() *tls.Config {
+	caCertPool := r.caPool.Load().(*x509.CertPool)
+	tlsConfig := &tls.Config{
+		RootCAs:        caCertPool,
+		GetCertificate: r.getCertificate,
+		ClientCAs:      caCertPool,
+	}
+	// enable client(apiserver) certificate verification if --clientAuth=true
+	if r.clientAuth {
+		tlsConfig.ClientAuth = tls.RequireAndVerifyClientCert
+	}
+	return tlsConfig
+}
+
+// fileWatcher calls reload whenever the content of one of its files changes. Kubernetes updates mounted
+// secrets and configmaps by swapping a symlink, so the file contents are compared instead of relying
+// on modification events.
+type fileWatcher struct {
+	name   string
+	files  []string
+	reload func() error
+	digest string
+}
+
+func newFileWatcher(name string, reload func() error, files ...string) *fileWatcher {
+	w := &fileWatcher{name: name, files: files, reload: reload}
+	w.digest, _ = digestFiles(files)
+	return w
+}
+
+// digestFiles returns the sha256 digest over the contents of files.
+func digestFiles(files []string) (string, error) {
+	hash := sha256.New()
+	for _, file := range files {
+		data, err := ioutil.ReadFile(file)
+		if err != nil {
+			return "", err
+		}
+		hash.Write(data)
+	}
+	return hex.EncodeToString(hash.Sum(nil)), nil
+}
+
+// check reloads if the files changed since the last successful reload. A failed reload is retried
+// on the next check, e.g. when the cert has been rotated but not the key yet.
+func (w *fileWatcher) check() {
+	digest, err := digestFiles(w.files)
+	if err != nil {
+		log.Errorf("Unable to read the %s files %v: %s", w.name, w.files, err.Error())
+		return
+	}
+	if digest == w.digest {
+		return
+	}
+	if err := w.reload(); err != nil {
+		log.Errorf("Failed to reload the %s, keeping the current one: %s", w.name, err.Error())
+		return
+	}
+	w.digest = digest
+	log.Infof("Reloaded the %s from %v", w.name, w.files)
+}
+
+// watchFiles polls the watchers every interval until stopCh is closed.
+func watchFiles(interval time.Duration, stopCh <-chan struct{}, watchers ...*fileWatcher) {
+	ticker := time.NewTicker(interval)
+	defer ticker.Stop()
+	for {
+		select {
+		case <-ticker.C:
+			for _, w := range watchers {
+				w.check()
+			}
+		case <-stopCh:
+			return
+		}
+	}
+}
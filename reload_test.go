@@ -0,0 +1,143 @@
+// Copyright 2017 Yahoo Holdings Inc. 
+// Licensed under the terms of the 3-Clause BSD License.
+package main
+
+import (
+	"crypto/ecdsa"
+	"crypto/elliptic"
+	"crypto/rand"
+	"crypto/x509"
+	"crypto/x509/pkix"
+	"encoding/pem"
+	"io/ioutil"
+	"math/big"
+	"os"
+	"path/filepath"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+)
+
+// writeTestCertificate writes a self-signed certificate for commonName and its key into dir
+func writeTestCertificate(dir, commonName string) (certFile, keyFile string) {
+	key, err := ecdsa.GenerateKey(elliptic.P256(), rand.Reader)
+	if err != nil {
+		panic(err.Error())
+	}
+	template := &x509.Certificate{
+		SerialNumber:          big.NewInt(time.Now().UnixNano()),
+		Subject:               pkix.Name{CommonName: commonName},
+		NotBefore:             time.Now().Add(-time.Hour),
+		NotAfter:              time.Now().Add(time.Hour),
+		IsCA:                  true,
+		BasicConstraintsValid: true,
+	}
+	der, err := x509.CreateCertificate(rand.Reader, template, template, &key.PublicKey, key)
+	if err != nil {
+		panic(err.Error())
+	}
+	keyDer, err := x509.MarshalECPrivateKey(key)
+	if err != nil {
+		panic(err.Error())
+	}
+
+	certFile = filepath.Join(dir, "server.crt")
+	keyFile = filepath.Join(dir, "server-key.pem")
+	if err := ioutil.WriteFile(certFile, pem.EncodeToMemory(&pem.Block{Type: "CERTIFICATE", Bytes: der}), 0600); err != nil {
+		panic(err.Error())
+	}
+	if err := ioutil.WriteFile(keyFile, pem.EncodeToMemory(&pem.Block{Type: "EC PRIVATE KEY", Bytes: keyDer}), 0600); err != nil {
+		panic(err.Error())
+	}
+	return certFile, keyFile
+}
+
+func servedCommonName(reloader *tlsReloader) string {
+	cert, err := reloader.getCertificate(nil)
+	if err != nil {
+		panic(err.Error())
+	}
+	leaf, err := x509.ParseCertificate(cert.Certificate[0])
+	if err != nil {
+		panic(err.Error())
+	}
+	return leaf.Subject.CommonName
+}
+
+func TestTLSReloader(t *testing.T) {
+	dir, err := ioutil.TempDir("", "tls")
+	assert.Nil(t, err, "Error should be nil")
+	defer os.RemoveAll(dir)
+
+	certFile, keyFile := writeTestCertificate(dir, "first")
+	reloader, err := newTLSReloader(certFile, keyFile, certFile, true)
+	assert.Nil(t, err, "Error should be nil")
+	assert.Equal(t, "first", servedCommonName(reloader))
+
+	config, err := reloader.getConfigForClient(nil)
+	assert.Nil(t, err, "Error should be nil")
+	assert.NotNil(t, config.ClientCAs, "client CA pool should be set")
+
+	certWatcher := newFileWatcher("server certificate", reloader.loadCertificate, certFile, keyFile)
+	certWatcher.check()
+	assert.Equal(t, "first", servedCommonName(reloader), "should not reload unchanged files")
+
+	writeTestCertificate(dir, "second")
+	certWatcher.check()
+	assert.Equal(t, "second", servedCommonName(reloader), "should serve the rotated certificate")
+}
+
+func TestTLSReloaderKeepsCertificateOnError(t *testing.T) {
+	dir, err := ioutil.TempDir("", "tls")
+	assert.Nil(t, err, "Error should be nil")
+	defer os.RemoveAll(dir)
+
+	certFile, keyFile := writeTestCertificate(dir, "first")
+	reloader, err := newTLSReloader(certFile, keyFile, certFile, false)
+	assert.Nil(t, err, "Error should be nil")
+
+	certWatcher := newFileWatcher("server certificate", reloader.loadCertificate, certFile, keyFile)
+	assert.Nil(t, ioutil.WriteFile(keyFile, []byte("not a key"), 0600))
+	certWatcher.check()
+	assert.Equal(t, "first", servedCommonName(reloader), "should keep serving the current certificate if the new pair is invalid")
+}
+
+func TestInvalidClientCA(t *testing.T) {
+	dir, err := ioutil.TempDir("", "tls")
+	assert.Nil(t, err, "Error should be nil")
+	defer os.RemoveAll(dir)
+
+	certFile, keyFile := writeTestCertificate(dir, "first")
+	caFile := filepath.Join(dir, "ca.crt")
+	assert.Nil(t, ioutil.WriteFile(caFile, []byte("not a certificate"), 0600))
+
+	_, err = newTLSReloader(certFile, keyFile, caFile, true)
+	assert.NotNil(t, err, "should fail if the client CA file has no certificates")
+	assert.Contains(t, err.Error(), "no PEM encoded certificates found in "+caFile)
+}
+
+func TestPolicyReload(t *testing.T) {
+	filename := writePolicyFile("resources:\n- resource: pods\n")
+	defer os.Remove(filename)
+	defer activePolicy.Store(currentPolicy())
+
+	reload := func() error {
+		p, err := loadPolicy(filename, false)
+		if err != nil {
+			return err
+		}
+		activePolicy.Store(p)
+		return nil
+	}
+	assert.Nil(t, reload(), "Error should be nil")
+	policyWatcher := newFileWatcher("policy", reload, filename)
+
+	assert.Nil(t, ioutil.WriteFile(filename, []byte("resources:\n- resource: pods\n  threshold: -1\n"), 0600))
+	policyWatcher.check()
+	assert.Equal(t, 0, currentPolicy().Resources[0].Threshold, "should keep the current policy if the new one is invalid")
+
+	assert.Nil(t, ioutil.WriteFile(filename, []byte("resources:\n- resource: pods\n  threshold: 3\n"), 0600))
+	policyWatcher.check()
+	assert.Equal(t, 3, currentPolicy().Resources[0].Threshold, "should swap in the reloaded policy")
+}
@@ -0,0 +1,207 @@
+// Copyright 2017 Yahoo Holdings Inc. 
+// Licensed under the terms of the 3-Clause BSD License.
+package main
+
+import (
+	"encoding/json"
+	"fmt"
+	"io"
+	"io/ioutil"
+	"net/http"
+	"time"
+
+	admissionv1beta1 "k8s.io/api/admission/v1beta1"
+	authenticationv1 "k8s.io/api/authentication/v1"
+	"k8s.io/apimachinery/pkg/apis/meta/v1"
+	"k8s.io/apimachinery/pkg/runtime"
+	"k8s.io/apimachinery/pkg/types"
+)
+
+const (
+	admissionV1alpha1 = "admission.k8s.io/v1alpha1"
+	admissionV1beta1  = "admission.k8s.io/v1beta1"
+	admissionV1       = "admission.k8s.io/v1"
+)
+
+// admissionReview is the admission.k8s.io/v1 and v1beta1 AdmissionReview. Both versions share the
+// same wire format, so a single type is declared for them.
+type admissionReview struct {
+	v1.TypeMeta `json:",inline"`
+	Request     *admissionRequest  `json:"request,omitempty"`
+	Response    *admissionResponse `json:"response,omitempty"`
+}
+
+// admissionRequest is the request stanza of a v1/v1beta1 AdmissionReview.
+// The Operation values are the same in every version, so the v1beta1 type is reused.
+type admissionRequest struct {
+	UID         types.UID                  `json:"uid"`
+	Kind        v1.GroupVersionKind        `json:"kind"`
+	Resource    v1.GroupVersionResource    `json:"resource"`
+	SubResource string                     `json:"subResource,omitempty"`
+	Name        string                     `json:"name,omitempty"`
+	Namespace   string                     `json:"namespace,omitempty"`
+	Operation   admissionv1beta1.Operation `json:"operation"`
+	UserInfo    authenticationv1.UserInfo  `json:"userInfo"`
+	Object      runtime.RawExtension       `json:"object,omitempty"`
+	OldObject   runtime.RawExtension       `json:"oldObject,omitempty"`
+	DryRun      *bool                      `json:"dryRun,omitempty"`
+}
+
+// admissionResponse is the response stanza of a v1/v1beta1 AdmissionReview.
+type admissionResponse struct {
+	UID      types.UID  `json:"uid"`
+	Allowed  bool       `json:"allowed"`
+	Result   *v1.Status `json:"status,omitempty"`
+	Warnings []string   `json:"warnings,omitempty"`
+}
+
+// legacyAdmissionReview is the admission.k8s.io/v1alpha1 AdmissionReview sent by Kubernetes 1.7 apiservers.
+// k8s.io/api no longer ships it, so it is declared here.
+type legacyAdmissionReview struct {
+	v1.TypeMeta `json:",inline"`
+	Spec        legacyAdmissionReviewSpec   `json:"spec,omitempty"`
+	Status      legacyAdmissionReviewStatus `json:"status,omitempty"`
+}
+
+// legacyAdmissionReviewSpec is the request stanza of a v1alpha1 AdmissionReview.
+type legacyAdmissionReviewSpec struct {
+	Kind        v1.GroupVersionKind        `json:"kind,omitempty"`
+	Object      runtime.RawExtension       `json:"object,omitempty"`
+	OldObject   runtime.RawExtension       `json:"oldObject,omitempty"`
+	Operation   admissionv1beta1.Operation `json:"operation,omitempty"`
+	Name        string                     `json:"name,omitempty"`
+	Namespace   string                     `json:"namespace,omitempty"`
+	Resource    v1.GroupVersionResource    `json:"resource,omitempty"`
+	SubResource string                     `json:"subResource,omitempty"`
+	UserInfo    authenticationv1.UserInfo  `json:"userInfo,omitempty"`
+}
+
+// legacyAdmissionReviewStatus is the response stanza of a v1alpha1 AdmissionReview.
+type legacyAdmissionReviewStatus struct {
+	Allowed bool       `json:"allowed"`
+	Result  *v1.Status `json:"status,omitempty"`
+}
+
+// reviewRequest is an incoming AdmissionReview normalized across the supported API versions.
+// apiVersion records the version the verdict has to be written back in, and warnings are returned
+// to the client along with it. v1alpha1 has no notion of warnings, they are dropped there.
+// reason records which check decided the verdict and rule the policy entry it matched, counts the
+// resources found in the namespace and start when the review was received, for the metrics and the logs.
+// causes are returned in the status details of a rejection.
+type reviewRequest struct {
+	admissionRequest
+	apiVersion string
+	legacy     *legacyAdmissionReview
+	warnings   []string
+	reason     string
+	rule       string
+	counts     map[string]int
+	causes     []v1.StatusCause
+	start      time.Time
+}
+
+// decodeReviewRequest detects the apiVersion of the AdmissionReview in body and decodes it.
+// The returned reviewRequest is never nil so that decoding errors can still be answered in kind.
+func decodeReviewRequest(body io.Reader) (*reviewRequest, error) {
+	review := &reviewRequest{apiVersion: admissionV1alpha1}
+
+	data, err := ioutil.ReadAll(body)
+	if err != nil {
+		return review, err
+	}
+
+	typeMeta := v1.TypeMeta{}
+	if err := json.Unmarshal(data, &typeMeta); err != nil {
+		return review, err
+	}
+
+	switch typeMeta.APIVersion {
+	case admissionV1beta1, admissionV1:
+		review.apiVersion = typeMeta.APIVersion
+		admReview := admissionReview{}
+		if err := json.Unmarshal(data, &admReview); err != nil {
+			return review, err
+		}
+		if admReview.Request == nil {
+			return review, fmt.Errorf("%s AdmissionReview does not contain a request", typeMeta.APIVersion)
+		}
+		review.admissionRequest = *admReview.Request
+	case "", admissionV1alpha1:
+		// v1alpha1 reviews sent by older apiservers may omit the apiVersion altogether
+		review.legacy = &legacyAdmissionReview{}
+		if err := json.Unmarshal(data, review.legacy); err != nil {
+			return review, err
+		}
+		spec := review.legacy.Spec
+		review.admissionRequest = admissionRequest{
+			Kind:        spec.Kind,
+			Resource:    spec.Resource,
+			SubResource: spec.SubResource,
+			Name:        spec.Name,
+			Namespace:   spec.Namespace,
+			Operation:   spec.Operation,
+			UserInfo:    spec.UserInfo,
+			Object:      spec.Object,
+			OldObject:   spec.OldObject,
+		}
+	default:
+		return review, fmt.Errorf("unsupported AdmissionReview apiVersion %q", typeMeta.APIVersion)
+	}
+	return review, nil
+}
+
+// encodeReviewResponse builds the AdmissionReview carrying the verdict in the apiVersion of the review.
+func encodeReviewResponse(review *reviewRequest, allowed bool, errorMsg string) interface{} {
+	switch review.apiVersion {
+	case admissionV1beta1, admissionV1:
+		// apiservers serving v1beta1 and v1 surface the message to the client, the reason is one of the
+		// machine-readable StatusReason values
+		result := &v1.Status{
+			Message: errorMsg,
+		}
+		if !allowed {
+			result.Reason = v1.StatusReasonForbidden
+			result.Code = http.StatusForbidden
+			result.Details = statusDetails(review)
+		}
+		return &admissionReview{
+			TypeMeta: v1.TypeMeta{
+				APIVersion: review.apiVersion,
+				Kind:       "AdmissionReview",
+			},
+			Response: &admissionResponse{
+				UID:      review.UID,
+				Allowed:  allowed,
+				Result:   result,
+				Warnings: review.warnings,
+			},
+		}
+	default:
+		admReview := review.legacy
+		if admReview == nil {
+			admReview = &legacyAdmissionReview{}
+		}
+		admReview.Status = legacyAdmissionReviewStatus{
+			Allowed: allowed,
+			Result: &v1.Status{
+				Reason: v1.StatusReason(errorMsg),
+			},
+		}
+		if !allowed {
+			admReview.Status.Result.Details = statusDetails(review)
+		}
+		return admReview
+	}
+}
+
+// statusDetails returns the details of a rejection listing its causes, or nil if there are none.
+func statusDetails(review *reviewRequest) *v1.StatusDetails {
+	if len(review.causes) == 0 {
+		return nil
+	}
+	return &v1.StatusDetails{
+		Name:   review.Name,
+		Kind:   "namespaces",
+		Causes: review.causes,
+	}
+}
@@ -0,0 +1,83 @@
+// Copyright 2017 Yahoo Holdings Inc. 
+// Licensed under the terms of the 3-Clause BSD License.
+package main
+
+import (
+	"sort"
+	"time"
+
+	"k8s.io/apimachinery/pkg/apis/meta/v1"
+)
+
+// riskCheck finds the resources whose deletion along with the namespace does damage beyond it, such as
+// volumes whose data is deleted. Any such resource blocks the deletion, whatever the thresholds, unless
+// the check only warns. A risk check is run as a resourceCounter that always lists from the apiserver,
+// as it looks beyond the metadata.
+type riskCheck struct {
+	// description tells what the resources are and why they block the deletion, following "The namespace <name>"
+	description string
+	causeType   v1.CauseType
+	// reason is the decision reason recorded when the check blocks the deletion, not_empty if unset
+	reason string
+	// describe returns the name of a resource along with what is at risk, e.g. "data-0 (10Gi)"
+	describe func(object v1.Object) string
+	// bypass, if set, are the annotations that skip the check, honored under the same rules as the bypass
+	// annotation. The bypass annotation does not cover such a check.
+	bypass *bypassAnnotations
+	// warn reports the resources as admission warnings instead of blocking the deletion
+	warn bool
+}
+
+// riskFinding are the resources found by a risk check, which the risk message template has access to.
+type riskFinding struct {
+	Kind        string
+	Description string
+	// Objects are the sorted descriptions of the resources, e.g. ["data-0 (10Gi)", "data-1 (20Gi)"]
+	Objects []string
+	// BypassAnnotationKey and BypassReasonAnnotationKey are the annotations that skip the check, if the bypass
+	// annotation does not cover it
+	BypassAnnotationKey       string
+	BypassReasonAnnotationKey string
+}
+
+// newRiskFinding returns the finding of the risk check of c among objects
+func newRiskFinding(c resourceCounter, objects []v1.Object) riskFinding {
+	finding := riskFinding{Kind: c.kind, Description: c.risk.description}
+	if c.risk.bypass != nil {
+		finding.BypassAnnotationKey, finding.BypassReasonAnnotationKey = c.risk.bypass.key, c.risk.bypass.reasonKey
+	}
+	for _, object := range objects {
+		finding.Objects = append(finding.Objects, c.risk.describe(object))
+	}
+	sort.Strings(finding.Objects)
+	return finding
+}
+
+// riskCounters returns the risk checks enabled on the command line and the dependency checks of the
+// policy, leaving out those whose own bypass annotation in annotations is honored. With bypassed, only
+// the checks the bypass annotation does not cover are returned.
+func riskCounters(annotations map[string]string, bypassed bool) []resourceCounter {
+	var counters []resourceCounter
+	for _, check := range []struct {
+		enabled bool
+		counter resourceCounter
+	}{
+		{*protectVolumes, volumeCheck},
+		{*protectAddrs, addressCheck},
+	} {
+		bypass := check.counter.risk.bypass
+		if !check.enabled || (bypassed && bypass == nil) {
+			continue
+		}
+		if bypass != nil {
+			if _, requested, err := bypass.parse(annotations, time.Now(), currentPolicy().Bypass.RequireExpiry); requested && err == nil {
+				continue
+			}
+		}
+		counters = append(counters, check.counter)
+	}
+	if !bypassed {
+		counters = append(counters, currentPolicy().Dependencies.counters()...)
+	}
+	return counters
+}
@@ -0,0 +1,68 @@
+// Copyright 2017 Yahoo Holdings Inc. 
+// Licensed under the terms of the 3-Clause BSD License.
+package main
+
+import (
+	"fmt"
+
+	corev1 "k8s.io/api/core/v1"
+	apiErrors "k8s.io/apimachinery/pkg/api/errors"
+	"k8s.io/apimachinery/pkg/apis/meta/v1"
+	"k8s.io/apimachinery/pkg/runtime/schema"
+)
+
+// causeTypeDataLoss is the type of the status causes listing the claims whose volumes would be deleted
+const causeTypeDataLoss v1.CauseType = "DataLoss"
+
+// volumeCheck blocks the deletion of namespaces holding claims whose volumes are deleted along with them
+var volumeCheck = resourceCounter{
+	kind:    "reclaim-delete-volumes",
+	gvr:     schema.GroupVersionResource{Group: "", Version: "v1", Resource: "persistentvolumeclaims"},
+	counter: deletableClaimCounter,
+	risk: &riskCheck{
+		description: "holds persistentvolumeclaims bound to volumes with the reclaim policy Delete, whose data would be deleted along with the namespace",
+		causeType:   causeTypeDataLoss,
+		reason:      reasonDataLoss,
+		describe:    describeClaim,
+	},
+}
+
+// deletableClaimCounter returns the claims in namespace bound to a volume with the reclaim policy Delete.
+// Volumes that are retained or recycled keep their data when the claim is deleted.
+func deletableClaimCounter(namespace string) ([]v1.Object, error) {
+	list, err := clientset.CoreV1().PersistentVolumeClaims(namespace).List(v1.ListOptions{})
+	if err != nil {
+		return nil, err
+	}
+	var objects []v1.Object
+	for i := range list.Items {
+		claim := &list.Items[i]
+		if claim.Status.Phase != corev1.ClaimBound || claim.Spec.VolumeName == "" {
+			continue
+		}
+		volume, err := clientset.CoreV1().PersistentVolumes().Get(claim.Spec.VolumeName, v1.GetOptions{})
+		if apiErrors.IsNotFound(err) {
+			continue
+		}
+		if err != nil {
+			return nil, fmt.Errorf("error getting the volume %s of %s, %v", claim.Spec.VolumeName, claim.Name, err)
+		}
+		if volume.Spec.PersistentVolumeReclaimPolicy == corev1.PersistentVolumeReclaimDelete {
+			objects = append(objects, claim)
+		}
+	}
+	return objects, nil
+}
+
+// describeClaim returns the name of a claim along with the capacity of its volume, e.g. "data-0 (10Gi)"
+func describeClaim(object v1.Object) string {
+	claim, ok := object.(*corev1.PersistentVolumeClaim)
+	if !ok {
+		return object.GetName()
+	}
+	capacity, ok := claim.Status.Capacity[corev1.ResourceStorage]
+	if !ok {
+		return claim.Name
+	}
+	return fmt.Sprintf("%s (%s)", claim.Name, capacity.String())
+}
@@ -0,0 +1,122 @@
+// Copyright 2017 Yahoo Holdings Inc. 
+// Licensed under the terms of the 3-Clause BSD License.
+package main
+
+import (
+	"net/http/httptest"
+	"testing"
+
+	corev1 "k8s.io/api/core/v1"
+	"k8s.io/apimachinery/pkg/api/resource"
+	"k8s.io/apimachinery/pkg/apis/meta/v1"
+	"k8s.io/client-go/kubernetes/fake"
+
+	"github.com/stretchr/testify/assert"
+)
+
+func newBoundClaim(name, volumeName, capacity string) *corev1.PersistentVolumeClaim {
+	return &corev1.PersistentVolumeClaim{
+		ObjectMeta: v1.ObjectMeta{Name: name, Namespace: "test-namespace"},
+		Spec:       corev1.PersistentVolumeClaimSpec{VolumeName: volumeName},
+		Status: corev1.PersistentVolumeClaimStatus{
+			Phase:    corev1.ClaimBound,
+			Capacity: corev1.ResourceList{corev1.ResourceStorage: resource.MustParse(capacity)},
+		},
+	}
+}
+
+func newVolume(name string, reclaimPolicy corev1.PersistentVolumeReclaimPolicy) *corev1.PersistentVolume {
+	return &corev1.PersistentVolume{
+		ObjectMeta: v1.ObjectMeta{Name: name},
+		Spec:       corev1.PersistentVolumeSpec{PersistentVolumeReclaimPolicy: reclaimPolicy},
+	}
+}
+
+func TestDeletableClaimCounter(t *testing.T) {
+	clientset = fake.NewSimpleClientset(
+		newBoundClaim("data-0", "pv-0", "10Gi"),
+		newVolume("pv-0", corev1.PersistentVolumeReclaimDelete),
+		newBoundClaim("backup-0", "pv-1", "50Gi"),
+		newVolume("pv-1", corev1.PersistentVolumeReclaimRetain),
+		&corev1.PersistentVolumeClaim{
+			ObjectMeta: v1.ObjectMeta{Name: "pending-0", Namespace: "test-namespace"},
+			Status:     corev1.PersistentVolumeClaimStatus{Phase: corev1.ClaimPending},
+		},
+		// the volume is gone already
+		newBoundClaim("lost-0", "pv-2", "1Gi"),
+	)
+
+	objects, err := deletableClaimCounter("test-namespace")
+	assert.Nil(t, err, "Error should be nil")
+	if assert.Len(t, objects, 1, "should only count the claims whose volume would be deleted") {
+		assert.Equal(t, "data-0 (10Gi)", describeClaim(objects[0]))
+	}
+}
+
+func TestDataLossWebhookHandler(t *testing.T) {
+	clientset = fake.NewSimpleClientset(
+		newBoundClaim("data-1", "pv-1", "20Gi"),
+		newBoundClaim("data-0", "pv-0", "10Gi"),
+		newVolume("pv-0", corev1.PersistentVolumeReclaimDelete),
+		newVolume("pv-1", corev1.PersistentVolumeReclaimDelete),
+		cloneNamespace(templateNamespace),
+	)
+
+	rejected := metricValue(admissionDecisions.WithLabelValues("rejected", reasonDataLoss, "DELETE"))
+
+	rw := httptest.NewRecorder()
+	req := httptest.NewRequest("POST", "http://localhost:8080/", constructPostBody(cloneAdmissionReview(templateAdmReview)))
+	webhookHandler(rw, req)
+
+	admReview := getAdmissionReview(rw)
+	assert.False(t, admReview.Status.Allowed, "should reject if volumes would be deleted along with the namespace")
+	assert.Equal(t, rejected+1, metricValue(admissionDecisions.WithLabelValues("rejected", reasonDataLoss, "DELETE")),
+		"should record the rejection as a data loss")
+	assert.Contains(t, admReview.Status.Result.Reason, "The namespace test-namespace holds persistentvolumeclaims bound to volumes with the reclaim policy Delete, "+
+		"whose data would be deleted along with the namespace: data-0 (10Gi), data-1 (20Gi).")
+	assert.NotContains(t, admReview.Status.Result.Reason, "contains one or more of these resources")
+	assert.Equal(t, []v1.StatusCause{{Type: causeTypeDataLoss, Field: "reclaim-delete-volumes", Message: "data-0 (10Gi), data-1 (20Gi)"}},
+		admReview.Status.Result.Details.Causes)
+
+	defer func(value bool) { *protectVolumes = value }(*protectVolumes)
+	*protectVolumes = false
+	rw = httptest.NewRecorder()
+	req = httptest.NewRequest("POST", "http://localhost:8080/", constructPostBody(cloneAdmissionReview(templateAdmReview)))
+	webhookHandler(rw, req)
+	assert.True(t, getAdmissionReview(rw).Status.Allowed, "should approve if volumes are not protected")
+}
+
+func TestCountedClaimsDataLoss(t *testing.T) {
+	clientset = fake.NewSimpleClientset(
+		newBoundClaim("data-1", "pv-1", "20Gi"),
+		newBoundClaim("data-0", "pv-0", "10Gi"),
+		newVolume("pv-0", corev1.PersistentVolumeReclaimDelete),
+		newVolume("pv-1", corev1.PersistentVolumeReclaimRetain),
+	)
+	claimCounter := resourceCounter{
+		kind:      "persistentvolumeclaims",
+		gvr:       volumeCheck.gvr,
+		threshold: 1,
+		counter: func(namespace string) ([]v1.Object, error) {
+			list, err := clientset.CoreV1().PersistentVolumeClaims(namespace).List(v1.ListOptions{})
+			if err != nil {
+				return nil, err
+			}
+			objects := make([]v1.Object, len(list.Items))
+			for i := range list.Items {
+				objects[i] = &list.Items[i]
+			}
+			return objects, nil
+		},
+	}
+
+	counts, _, _, err := countResources("test-namespace", []resourceCounter{claimCounter, volumeCheck}, 0, nil)
+	assert.Equal(t, map[string]int{"persistentvolumeclaims": 2}, counts, "should count the claims apart from the volume check")
+	if assert.IsType(t, &validationError{}, err) {
+		assert.Equal(t, reasonDataLoss, err.(*validationError).reason)
+		assert.Equal(t, []v1.StatusCause{
+			{Type: causeTypeDataLoss, Field: "reclaim-delete-volumes", Message: "data-0 (10Gi)"},
+			{Type: causeTypeBlockingResources, Field: "persistentvolumeclaims", Message: "2 persistentvolumeclaims: data-0, data-1"},
+		}, err.(*validationError).causes)
+	}
+}